@@ -1,9 +1,13 @@
 // Package log implements a simple logging package. It provides functions
-// Debug, Info, Error, Fatal, Panic plus formatting variants such as
+// Debug, Info, Warn, Error, Fatal, Panic plus formatting variants such as
 // Infof.
 package log
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"sync"
@@ -39,6 +43,7 @@ type Level int
 const (
 	DebugLevel Level = iota
 	InfoLevel
+	WarnLevel
 	ErrorLevel
 	DisabledLevel
 )
@@ -46,13 +51,16 @@ const (
 type state struct {
 	sync.RWMutex
 	level Level
+	panic func(msg string)
 }
 
 var global *state
 
 func init() { global = &state{} }
 
-// SetLevel sets the current level of logging.
+// SetLevel sets the current level of logging. Setting DisabledLevel
+// turns off all output except Fatal and Panic; disabled calls return
+// before any message is formatted.
 func SetLevel(level Level) {
 	global.Lock()
 	global.level = level
@@ -67,39 +75,120 @@ func getLevel() Level {
 	return level
 }
 
+// Enabled reports whether messages at the given level are logged. It
+// can be used to guard the construction of expensive arguments:
+//
+//	if log.Enabled(log.DebugLevel) {
+//		log.Debugf("state: %v", dump())
+//	}
+func Enabled(level Level) bool {
+	return level >= getLevel()
+}
+
+// SetPanicHandler sets a function that is called with the formatted
+// message before Panic or Panicf panics. A nil handler disables it.
+func SetPanicHandler(handler func(msg string)) {
+	global.Lock()
+	global.panic = handler
+	global.Unlock()
+}
+
+// getPanicHandler returns the current panic handler.
+func getPanicHandler() func(msg string) {
+	global.RLock()
+	handler := global.panic
+	global.RUnlock()
+	return handler
+}
+
+// SetOutput sets the destination of the default loggers. A nil writer
+// restores os.Stderr. Prefixes and flags are preserved.
+func SetOutput(w io.Writer) {
+	if w == nil {
+		w = os.Stderr
+	}
+	output.mu.Lock()
+	output.w = w
+	output.mu.Unlock()
+}
+
+// Output returns the destination of the default loggers.
+func Output() io.Writer {
+	output.mu.Lock()
+	w := output.w
+	output.mu.Unlock()
+	return w
+}
+
 // Debugf log to the debug logs. Arguments are handled in the manner
 // of fmt.Printf; a newline is appended if missing.
 func Debugf(format string, args ...interface{}) {
+	if !Enabled(DebugLevel) {
+		return
+	}
 	debugLog.Printf(format, args...)
 }
 
 // Debug log to the debug logs. Arguments are handled in the manner
 // of fmt.Print; a newline is appended if missing.
 func Debug(args ...interface{}) {
+	if !Enabled(DebugLevel) {
+		return
+	}
 	debugLog.Print(args...)
 }
 
 // Infof log to the info logs. Arguments are handled in the manner
 // of fmt.Printf; a newline is appended if missing.
 func Infof(format string, args ...interface{}) {
+	if !Enabled(InfoLevel) {
+		return
+	}
 	infoLog.Printf(format, args...)
 }
 
 // Info log to the info logs. Arguments are handled in the manner
 // of fmt.Print; a newline is appended if missing.
 func Info(args ...interface{}) {
+	if !Enabled(InfoLevel) {
+		return
+	}
 	infoLog.Print(args...)
 }
 
+// Warnf log to the warning logs. Arguments are handled in the manner
+// of fmt.Printf; a newline is appended if missing.
+func Warnf(format string, args ...interface{}) {
+	if !Enabled(WarnLevel) {
+		return
+	}
+	warnLog.Printf(format, args...)
+}
+
+// Warn log to the warning logs. Arguments are handled in the manner
+// of fmt.Print; a newline is appended if missing.
+func Warn(args ...interface{}) {
+	if !Enabled(WarnLevel) {
+		return
+	}
+	warnLog.Print(args...)
+}
+
 // Errorf log to the error logs. Arguments are handled in the manner
 // of fmt.Printf; a newline is appended if missing.
 func Errorf(format string, args ...interface{}) {
+	if !Enabled(ErrorLevel) {
+		return
+	}
 	errorLog.Printf(format, args...)
 }
 
 // Error log to the error logs. Arguments are handled in the manner
 // of fmt.Print; a newline is appended if missing.
 func Error(args ...interface{}) {
+	if !Enabled(ErrorLevel) {
+		return
+	}
 	errorLog.Print(args...)
 }
 
@@ -131,20 +220,108 @@ func Panic(args ...interface{}) {
 	fatalLog.Panic(args...)
 }
 
+// Writer returns an io.Writer that writes each message to the default
+// logger for the given level. Messages are subject to the current log
+// level. Writer(DisabledLevel) discards all messages.
+func Writer(level Level) io.Writer {
+	switch level {
+	case DebugLevel:
+		return &writer{debugLog}
+	case InfoLevel:
+		return &writer{infoLog}
+	case WarnLevel:
+		return &writer{warnLog}
+	case ErrorLevel:
+		return &writer{errorLog}
+	}
+	return ioutil.Discard
+}
+
+type writer struct {
+	log Logger
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.log.Print(string(bytes.TrimSuffix(p, []byte{'\n'})))
+	return len(p), nil
+}
+
+// RedirectStdLog redirects the output of the standard library's log
+// package to the default logger for the given level. It returns a
+// function that restores the previous output, prefix and flags.
+func RedirectStdLog(level Level) func() {
+	out, prefix, flags := log.Writer(), log.Prefix(), log.Flags()
+	log.SetOutput(Writer(level))
+	log.SetPrefix("")
+	log.SetFlags(0)
+	return func() {
+		log.SetOutput(out)
+		log.SetPrefix(prefix)
+		log.SetFlags(flags)
+	}
+}
+
+// AsStdLogger returns a standard library logger that writes each message
+// to l. The returned logger adds no prefix or flags of its own.
+func AsStdLogger(l Logger) *log.Logger {
+	return log.New(&writer{l}, "", 0)
+}
+
+// FromStdLogger creates a new level logger writing to the standard
+// library logger l.
+func FromStdLogger(l *log.Logger, level Level) Logger {
+	return New(l, level)
+}
+
 var _ Logger = (*logger)(nil)
 
-func newStdLogger(prefix string) *log.Logger {
-	return log.New(os.Stderr, prefix, defLogFlags)
+func newStdLogger(level Level) *log.Logger {
+	if level == DisabledLevel {
+		return log.New(unlimitedWriter{output}, defaultPrefix(level), defLogFlags)
+	}
+	return log.New(output, defaultPrefix(level), defLogFlags)
+}
+
+// defaultPrefix returns the default line prefix of the default logger
+// for the given level. DisabledLevel denotes the fatal logger.
+func defaultPrefix(level Level) string {
+	switch level {
+	case DebugLevel:
+		return "DEBUG "
+	case InfoLevel:
+		return "INFO  "
+	case WarnLevel:
+		return "WARN  "
+	case ErrorLevel:
+		return "ERROR "
+	}
+	return "FATAL "
 }
 
 // Default loggers for each log level.
 var (
-	debugLog = &logger{newStdLogger("DEBUG "), DebugLevel}
-	infoLog  = &logger{newStdLogger("INFO  "), InfoLevel}
-	errorLog = &logger{newStdLogger("ERROR "), ErrorLevel}
-	fatalLog = &logger{newStdLogger("FATAL "), DisabledLevel}
+	debugLog = &logger{newStdLogger(DebugLevel), DebugLevel}
+	infoLog  = &logger{newStdLogger(InfoLevel), InfoLevel}
+	warnLog  = &logger{newStdLogger(WarnLevel), WarnLevel}
+	errorLog = &logger{newStdLogger(ErrorLevel), ErrorLevel}
+	fatalLog = &logger{newStdLogger(DisabledLevel), DisabledLevel}
 )
 
+// SetPrefixFunc sets the function that returns the line prefix of the
+// default loggers for each level. The Fatal and Panic functions use the
+// prefix returned for DisabledLevel. A nil function restores the default
+// prefixes.
+func SetPrefixFunc(fn func(Level) string) {
+	if fn == nil {
+		fn = defaultPrefix
+	}
+	for _, l := range []*logger{debugLog, infoLog, warnLog, errorLog, fatalLog} {
+		if std, ok := l.log.(*log.Logger); ok {
+			std.SetPrefix(fn(l.level))
+		}
+	}
+}
+
 type logger struct {
 	log   Logger
 	level Level
@@ -181,9 +358,15 @@ func (l *logger) Fatalf(format string, args ...interface{}) {
 }
 
 func (l *logger) Panic(args ...interface{}) {
+	if handler := getPanicHandler(); handler != nil {
+		handler(fmt.Sprint(args...))
+	}
 	l.log.Panic(args...)
 }
 
 func (l *logger) Panicf(format string, args ...interface{}) {
+	if handler := getPanicHandler(); handler != nil {
+		handler(fmt.Sprintf(format, args...))
+	}
 	l.log.Panicf(format, args...)
 }
@@ -1,7 +1,12 @@
 package log
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -74,16 +79,25 @@ func TestLevel(t *testing.T) {
 	}{
 		{DebugLevel, "log line", true, DebugLevel},
 		{DebugLevel, "", true, InfoLevel},
+		{DebugLevel, "", true, WarnLevel},
 		{DebugLevel, "", true, ErrorLevel},
 		{DebugLevel, "", true, DisabledLevel},
 
 		{InfoLevel, "log line", true, DebugLevel},
 		{InfoLevel, "log line", true, InfoLevel},
+		{InfoLevel, "", true, WarnLevel},
 		{InfoLevel, "", true, ErrorLevel},
 		{InfoLevel, "", true, DisabledLevel},
 
+		{WarnLevel, "log line", true, DebugLevel},
+		{WarnLevel, "log line", true, InfoLevel},
+		{WarnLevel, "log line", true, WarnLevel},
+		{WarnLevel, "", true, ErrorLevel},
+		{WarnLevel, "", true, DisabledLevel},
+
 		{ErrorLevel, "log line", true, DebugLevel},
 		{ErrorLevel, "log line", true, InfoLevel},
+		{ErrorLevel, "log line", true, WarnLevel},
 		{ErrorLevel, "log line", true, ErrorLevel},
 		{ErrorLevel, "", true, DisabledLevel},
 	} {
@@ -92,3 +106,136 @@ func TestLevel(t *testing.T) {
 		ml.verify(t, i)
 	}
 }
+
+func TestPanicHandler(t *testing.T) {
+	var got []string
+	SetPanicHandler(func(msg string) { got = append(got, msg) })
+	defer SetPanicHandler(nil)
+
+	ml := newMockLogger(ErrorLevel, "", true)
+	l := New(ml, ml.level)
+	l.Panic("panic ", "line")
+	l.Panicf("panic %s", "line")
+	ml.verify(t, 0)
+
+	if len(got) != 2 || got[0] != "panic line" || got[1] != "panic line" {
+		t.Fatalf("panic handler: expected two %q messages, got %q", "panic line", got)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	defer SetLevel(DebugLevel)
+
+	SetLevel(InfoLevel)
+	if Enabled(DebugLevel) {
+		t.Errorf("enabled: expected debug level to be disabled")
+	}
+	if !Enabled(InfoLevel) || !Enabled(ErrorLevel) {
+		t.Errorf("enabled: expected info and error level to be enabled")
+	}
+
+	SetLevel(DisabledLevel)
+	if Enabled(ErrorLevel) {
+		t.Errorf("enabled: expected error level to be disabled")
+	}
+}
+
+func BenchmarkDisabled(b *testing.B) {
+	SetLevel(DisabledLevel)
+	defer SetLevel(DebugLevel)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Infof("message %d", 42)
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	defer SetLevel(DebugLevel)
+	SetLevel(DebugLevel)
+
+	ml := newMockLogger(InfoLevel, "std line", false)
+	saved := infoLog
+	infoLog = &logger{ml, InfoLevel}
+	defer func() { infoLog = saved }()
+
+	restore := RedirectStdLog(InfoLevel)
+	stdlog.Print("std line")
+	restore()
+	ml.verify(t, 0)
+
+	if stdlog.Flags() != stdlog.LstdFlags {
+		t.Errorf("redirect: expected restored flags %d, got %d", stdlog.LstdFlags, stdlog.Flags())
+	}
+}
+
+func TestPrefixFunc(t *testing.T) {
+	defer SetPrefixFunc(nil)
+
+	SetPrefixFunc(func(level Level) string {
+		return [...]string{"D ", "I ", "W ", "E ", "F "}[level]
+	})
+	for _, l := range []*logger{debugLog, infoLog, warnLog, errorLog, fatalLog} {
+		want := [...]string{"D ", "I ", "W ", "E ", "F "}[l.level]
+		if prefix := l.log.(*stdlog.Logger).Prefix(); prefix != want {
+			t.Errorf("prefix: expected %q, got %q", want, prefix)
+		}
+	}
+
+	SetPrefixFunc(nil)
+	if prefix := infoLog.log.(*stdlog.Logger).Prefix(); prefix != "INFO  " {
+		t.Errorf("prefix: expected %q, got %q", "INFO  ", prefix)
+	}
+}
+
+func TestStdLoggerAdapters(t *testing.T) {
+	defer SetLevel(DebugLevel)
+	SetLevel(InfoLevel)
+
+	ml := newMockLogger(InfoLevel, "std line", false)
+	AsStdLogger(ml).Printf("std %s", "line")
+	ml.verify(t, 0)
+
+	var buf bytes.Buffer
+	l := FromStdLogger(stdlog.New(&buf, "", 0), DebugLevel)
+	l.Print("debug line")
+	if buf.Len() != 0 {
+		t.Fatalf("adapter: expected debug line to be disabled, got %q", buf.String())
+	}
+	l = FromStdLogger(stdlog.New(&buf, "", 0), InfoLevel)
+	l.Print("info line")
+	if buf.String() != "info line\n" {
+		t.Fatalf("adapter: expected %q, got %q", "info line\n", buf.String())
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	defer SetOutput(nil)
+
+	buf := &bytes.Buffer{}
+	SetOutput(buf)
+	if Output() != buf {
+		t.Fatalf("output: expected buffer as output")
+	}
+	Error("hello")
+	if !strings.HasPrefix(buf.String(), "ERROR ") || !strings.HasSuffix(buf.String(), " hello\n") {
+		t.Errorf("output: unexpected message %q", buf.String())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			Errorf("message %d", i)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		SetOutput(ioutil.Discard)
+	}
+	<-done
+
+	SetOutput(nil)
+	if Output() != os.Stderr {
+		t.Errorf("output: expected os.Stderr after SetOutput(nil)")
+	}
+}
@@ -0,0 +1,93 @@
+package log
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// output is the destination of the default loggers.
+var output = &rateWriter{w: os.Stderr, now: time.Now}
+
+// SetByteRateLimit limits the output of the default loggers to
+// bytesPerSec bytes per second, allowing bursts of up to one second.
+// Messages exceeding the limit are dropped; the number of dropped bytes
+// is reported with the next message written, and at least once per
+// second while messages are dropped. Fatal and Panic messages are never
+// dropped. A value of bytesPerSec <= 0 removes the limit.
+func SetByteRateLimit(bytesPerSec int) {
+	output.setRate(bytesPerSec)
+}
+
+// rateWriter is a token bucket limiting the bytes written per second.
+type rateWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	now     func() time.Time
+	rate    int     // bytes per second, <= 0 if unlimited
+	tokens  float64 // available bytes
+	last    time.Time
+	dropped int       // bytes dropped since the last note
+	noted   time.Time // time of the last note
+}
+
+func (w *rateWriter) setRate(rate int) {
+	w.mu.Lock()
+	w.rate = rate
+	w.tokens = float64(rate)
+	w.last = w.now()
+	w.noted = w.last
+	w.mu.Unlock()
+}
+
+func (w *rateWriter) Write(p []byte) (int, error) {
+	return w.write(p, true)
+}
+
+func (w *rateWriter) write(p []byte, limited bool) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if limited && w.rate > 0 {
+		now := w.now()
+		w.tokens += now.Sub(w.last).Seconds() * float64(w.rate)
+		if w.tokens > float64(w.rate) {
+			w.tokens = float64(w.rate)
+		}
+		w.last = now
+
+		if float64(len(p)) > w.tokens {
+			// Lines longer than the rate never pass, so the note
+			// cannot wait for the next message written.
+			w.dropped += len(p)
+			if now.Sub(w.noted) >= time.Second {
+				w.note(now)
+			}
+			return len(p), nil
+		}
+		w.tokens -= float64(len(p))
+	}
+
+	if w.dropped > 0 {
+		w.note(w.now())
+	}
+	return w.w.Write(p)
+}
+
+// note reports the number of dropped bytes. w.mu must be held.
+func (w *rateWriter) note(now time.Time) {
+	fmt.Fprintf(w.w, "(throttled %d bytes)\n", w.dropped)
+	w.dropped = 0
+	w.noted = now
+}
+
+// unlimitedWriter writes to a rateWriter, bypassing its limit.
+type unlimitedWriter struct {
+	w *rateWriter
+}
+
+func (w unlimitedWriter) Write(p []byte) (int, error) {
+	return w.w.write(p, false)
+}
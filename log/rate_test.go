@@ -0,0 +1,60 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRateWriter(t *testing.T) {
+	now := time.Unix(0, 0)
+	buf := &bytes.Buffer{}
+	w := &rateWriter{w: buf, now: func() time.Time { return now }}
+
+	w.setRate(11)
+	for _, msg := range []string{"aaaaa\n", "bbbb\n", "cccc\n"} {
+		if n, err := w.Write([]byte(msg)); n != len(msg) || err != nil {
+			t.Fatalf("rate: write returned (%d, %v)", n, err)
+		}
+	}
+	if got, want := buf.String(), "aaaaa\nbbbb\n"; got != want {
+		t.Fatalf("rate: expected output %q, got %q", want, got)
+	}
+
+	unlimitedWriter{w}.Write([]byte("fatal\n"))
+	now = now.Add(time.Second)
+	w.Write([]byte("dddd\n"))
+	if got, want := buf.String(), "aaaaa\nbbbb\n(throttled 5 bytes)\nfatal\ndddd\n"; got != want {
+		t.Fatalf("rate: expected output %q, got %q", want, got)
+	}
+
+	buf.Reset()
+	w.setRate(0)
+	for i := 0; i < 100; i++ {
+		w.Write([]byte("eeee\n"))
+	}
+	if buf.Len() != 500 {
+		t.Fatalf("rate: expected unlimited output of 500 bytes, got %d", buf.Len())
+	}
+}
+
+func TestRateWriterLongLines(t *testing.T) {
+	now := time.Unix(0, 0)
+	buf := &bytes.Buffer{}
+	w := &rateWriter{w: buf, now: func() time.Time { return now }}
+
+	w.setRate(4)
+	line := []byte("0123456789\n") // longer than the rate
+	w.Write(line)
+	now = now.Add(500 * time.Millisecond)
+	w.Write(line)
+	if buf.Len() != 0 {
+		t.Fatalf("rate: expected no output within the first second, got %q", buf.String())
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	w.Write(line)
+	if got, want := buf.String(), "(throttled 33 bytes)\n"; got != want {
+		t.Fatalf("rate: expected output %q, got %q", want, got)
+	}
+}
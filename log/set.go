@@ -0,0 +1,120 @@
+package log
+
+import (
+	"io"
+	"log"
+	"sync"
+)
+
+// LoggerSet is a self-contained set of leveled loggers writing to a
+// single destination. Unlike the package-level functions, a LoggerSet
+// is gated by its own level and does not depend on global state.
+//
+// A LoggerSet is safe for use by multiple goroutines simultaneously.
+type LoggerSet struct {
+	mu    sync.RWMutex
+	level Level
+	logs  [DisabledLevel + 1]*log.Logger // DisabledLevel is the fatal logger
+}
+
+// NewSet creates a new set of leveled loggers writing to w, logging
+// messages at or above level.
+func NewSet(w io.Writer, level Level) *LoggerSet {
+	s := &LoggerSet{level: level}
+	for l := range s.logs {
+		s.logs[l] = log.New(w, defaultPrefix(Level(l)), defLogFlags)
+	}
+	return s
+}
+
+// SetLevel sets the current level of logging of s.
+func (s *LoggerSet) SetLevel(level Level) {
+	s.mu.Lock()
+	s.level = level
+	s.mu.Unlock()
+}
+
+// Enabled reports whether messages at the given level are logged by s.
+func (s *LoggerSet) Enabled(level Level) bool {
+	s.mu.RLock()
+	enabled := level >= s.level
+	s.mu.RUnlock()
+	return enabled
+}
+
+// SetPrefixFunc sets the function that returns the line prefix of s for
+// each level, as SetPrefixFunc does for the default loggers.
+func (s *LoggerSet) SetPrefixFunc(fn func(Level) string) {
+	if fn == nil {
+		fn = defaultPrefix
+	}
+	for l, std := range s.logs {
+		std.SetPrefix(fn(Level(l)))
+	}
+}
+
+// Debugf logs to the debug log of s in the manner of fmt.Printf.
+func (s *LoggerSet) Debugf(format string, args ...interface{}) {
+	s.printf(DebugLevel, format, args...)
+}
+
+// Debug logs to the debug log of s in the manner of fmt.Print.
+func (s *LoggerSet) Debug(args ...interface{}) { s.print(DebugLevel, args...) }
+
+// Infof logs to the info log of s in the manner of fmt.Printf.
+func (s *LoggerSet) Infof(format string, args ...interface{}) {
+	s.printf(InfoLevel, format, args...)
+}
+
+// Info logs to the info log of s in the manner of fmt.Print.
+func (s *LoggerSet) Info(args ...interface{}) { s.print(InfoLevel, args...) }
+
+// Warnf logs to the warning log of s in the manner of fmt.Printf.
+func (s *LoggerSet) Warnf(format string, args ...interface{}) {
+	s.printf(WarnLevel, format, args...)
+}
+
+// Warn logs to the warning log of s in the manner of fmt.Print.
+func (s *LoggerSet) Warn(args ...interface{}) { s.print(WarnLevel, args...) }
+
+// Errorf logs to the error log of s in the manner of fmt.Printf.
+func (s *LoggerSet) Errorf(format string, args ...interface{}) {
+	s.printf(ErrorLevel, format, args...)
+}
+
+// Error logs to the error log of s in the manner of fmt.Print.
+func (s *LoggerSet) Error(args ...interface{}) { s.print(ErrorLevel, args...) }
+
+// Fatalf logs to the fatal log of s, regardless of its level, and
+// aborts.
+func (s *LoggerSet) Fatalf(format string, args ...interface{}) {
+	s.logs[DisabledLevel].Fatalf(format, args...)
+}
+
+// Fatal logs to the fatal log of s, regardless of its level, and aborts.
+func (s *LoggerSet) Fatal(args ...interface{}) {
+	s.logs[DisabledLevel].Fatal(args...)
+}
+
+// Panicf logs to the fatal log of s, regardless of its level, and
+// panics.
+func (s *LoggerSet) Panicf(format string, args ...interface{}) {
+	s.logs[DisabledLevel].Panicf(format, args...)
+}
+
+// Panic logs to the fatal log of s, regardless of its level, and panics.
+func (s *LoggerSet) Panic(args ...interface{}) {
+	s.logs[DisabledLevel].Panic(args...)
+}
+
+func (s *LoggerSet) printf(level Level, format string, args ...interface{}) {
+	if s.Enabled(level) {
+		s.logs[level].Printf(format, args...)
+	}
+}
+
+func (s *LoggerSet) print(level Level, args ...interface{}) {
+	if s.Enabled(level) {
+		s.logs[level].Print(args...)
+	}
+}
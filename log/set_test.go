@@ -0,0 +1,38 @@
+package log
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLoggerSet(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSet(&buf, WarnLevel)
+	SetLevel(DisabledLevel) // must not affect s
+	defer SetLevel(DebugLevel)
+
+	s.Debug("debug line")
+	s.Infof("info %s", "line")
+	s.Warn("warn line")
+	s.Errorf("error %s", "line")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("set: expected 2 lines, got %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "WARN  ") || !strings.HasSuffix(lines[0], "warn line") {
+		t.Errorf("set: unexpected warning line %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "ERROR ") || !strings.HasSuffix(lines[1], "error line") {
+		t.Errorf("set: unexpected error line %q", lines[1])
+	}
+
+	buf.Reset()
+	s.SetLevel(DebugLevel)
+	s.SetPrefixFunc(func(Level) string { return "" })
+	s.Debug("debug line")
+	if line := buf.String(); !strings.HasSuffix(line, " debug line\n") || strings.HasPrefix(line, "DEBUG") {
+		t.Errorf("set: unexpected debug line %q", line)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+	"fmt"
+	"log/syslog"
+	"os"
+)
+
+// Syslog is a connection to the system log daemon. Level loggers created
+// by Logger share the connection.
+type Syslog struct {
+	w *syslog.Writer
+}
+
+// NewSyslog opens a connection to the system log daemon. Messages are
+// tagged with tag.
+func NewSyslog(tag string) (*Syslog, error) {
+	w, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &Syslog{w: w}, nil
+}
+
+// Logger returns a level logger writing to s. Messages are logged with
+// the syslog severity matching level; Fatal and Panic messages are
+// logged as critical.
+func (s *Syslog) Logger(level Level) Logger {
+	return New(&syslogLogger{w: s.w, level: level}, level)
+}
+
+// Close closes the connection to the system log daemon.
+func (s *Syslog) Close() error {
+	return s.w.Close()
+}
+
+// severity maps level to a syslog severity.
+func severity(level Level) syslog.Priority {
+	switch level {
+	case DebugLevel:
+		return syslog.LOG_DEBUG
+	case InfoLevel:
+		return syslog.LOG_INFO
+	case WarnLevel:
+		return syslog.LOG_WARNING
+	case ErrorLevel:
+		return syslog.LOG_ERR
+	}
+	return syslog.LOG_CRIT
+}
+
+type syslogLogger struct {
+	w     *syslog.Writer
+	level Level
+}
+
+func (l *syslogLogger) write(msg string) {
+	switch severity(l.level) {
+	case syslog.LOG_DEBUG:
+		l.w.Debug(msg)
+	case syslog.LOG_INFO:
+		l.w.Info(msg)
+	case syslog.LOG_WARNING:
+		l.w.Warning(msg)
+	case syslog.LOG_ERR:
+		l.w.Err(msg)
+	default:
+		l.w.Crit(msg)
+	}
+}
+
+func (l *syslogLogger) Printf(format string, args ...interface{}) {
+	l.write(fmt.Sprintf(format, args...))
+}
+
+func (l *syslogLogger) Print(args ...interface{}) {
+	l.write(fmt.Sprint(args...))
+}
+
+func (l *syslogLogger) Fatal(args ...interface{}) {
+	l.w.Crit(fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+func (l *syslogLogger) Fatalf(format string, args ...interface{}) {
+	l.w.Crit(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (l *syslogLogger) Panic(args ...interface{}) {
+	msg := fmt.Sprint(args...)
+	l.w.Crit(msg)
+	panic(msg)
+}
+
+func (l *syslogLogger) Panicf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	l.w.Crit(msg)
+	panic(msg)
+}
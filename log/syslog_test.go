@@ -0,0 +1,38 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package log
+
+import (
+	"io"
+	"log/syslog"
+	"testing"
+)
+
+func TestSyslogSeverity(t *testing.T) {
+	for level, want := range map[Level]syslog.Priority{
+		DebugLevel:    syslog.LOG_DEBUG,
+		InfoLevel:     syslog.LOG_INFO,
+		WarnLevel:     syslog.LOG_WARNING,
+		ErrorLevel:    syslog.LOG_ERR,
+		DisabledLevel: syslog.LOG_CRIT,
+	} {
+		if got := severity(level); got != want {
+			t.Errorf("syslog: expected severity %d for level %d, got %d", want, level, got)
+		}
+	}
+}
+
+func TestSyslog(t *testing.T) {
+	s, err := NewSyslog("azmodb-test")
+	if err != nil {
+		t.Skipf("syslog: daemon not available: %v", err)
+	}
+	var _ io.Closer = s
+
+	s.Logger(DebugLevel).Print("debug message")
+	s.Logger(ErrorLevel).Printf("error %s", "message")
+	if err := s.Close(); err != nil {
+		t.Fatalf("syslog: close failed: %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Size classes of ByteSlicePool, as powers of two.
+const (
+	minSizeClass = 6  // 64 bytes
+	maxSizeClass = 16 // 64 KiB
+)
+
+// ByteSlicePool is a set of byte slices grouped into power of two size
+// classes. Slices larger than the largest size class are not pooled.
+//
+// The zero value is ready to use. A ByteSlicePool is safe for use by
+// multiple goroutines simultaneously.
+type ByteSlicePool struct {
+	classes [maxSizeClass - minSizeClass + 1]sync.Pool // of *[]byte
+
+	// headers recycles the *[]byte values stored in classes, so that
+	// neither Get nor Put allocates in the steady state.
+	headers sync.Pool
+}
+
+// Get returns an empty byte slice with a capacity of at least min bytes.
+func (p *ByteSlicePool) Get(min int) []byte {
+	class := minSizeClass
+	if min > 1<<minSizeClass {
+		class = bits.Len(uint(min - 1))
+	}
+	if class > maxSizeClass {
+		return make([]byte, 0, min)
+	}
+
+	if ptr, ok := p.classes[class-minSizeClass].Get().(*[]byte); ok {
+		b := *ptr
+		*ptr = nil
+		p.headers.Put(ptr)
+		return b[:0]
+	}
+	return make([]byte, 0, 1<<uint(class))
+}
+
+// Put returns b to the pool. Slices with a capacity below the smallest
+// size class are discarded.
+func (p *ByteSlicePool) Put(b []byte) {
+	class := bits.Len(uint(cap(b))) - 1
+	if class < minSizeClass || class > maxSizeClass {
+		return
+	}
+	ptr, ok := p.headers.Get().(*[]byte)
+	if !ok {
+		ptr = new([]byte)
+	}
+	*ptr = b[:0]
+	p.classes[class-minSizeClass].Put(ptr)
+}
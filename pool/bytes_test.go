@@ -0,0 +1,45 @@
+package pool
+
+import "testing"
+
+func TestByteSlicePool(t *testing.T) {
+	var p ByteSlicePool
+	for i, testcase := range []struct {
+		min int
+		cap int
+	}{
+		{0, 64},
+		{1, 64},
+		{64, 64},
+		{65, 128},
+		{1000, 1024},
+		{1 << 16, 1 << 16},
+		{1<<16 + 1, 1<<16 + 1},
+	} {
+		b := p.Get(testcase.min)
+		if len(b) != 0 {
+			t.Errorf("bytes (%.4d): expected empty slice, got length %d", i, len(b))
+		}
+		if cap(b) != testcase.cap {
+			t.Errorf("bytes (%.4d): expected capacity %d, got %d", i, testcase.cap, cap(b))
+		}
+		p.Put(b)
+	}
+
+	p.Put(make([]byte, 10, 100)) // pooled in the 64 byte class
+	for i := 0; i < 8; i++ {
+		if b := p.Get(64); cap(b) < 64 {
+			t.Fatalf("bytes: expected capacity of at least 64, got %d", cap(b))
+		}
+	}
+
+	if raceEnabled {
+		return // sync.Pool randomly drops values with the race detector
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		p.Put(p.Get(1000))
+	})
+	if allocs != 0 {
+		t.Fatalf("bytes: expected no allocations per Get/Put, got %v", allocs)
+	}
+}
@@ -1,46 +1,219 @@
 package pool
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sync"
+)
 
 // Generator represents a numeric identifier allocator. It can be used for
 // both tags and fids.
 //
 // A Generator is safe for use by multiple goroutines simultaneously.
 type Generator struct {
-	mu    sync.Mutex
-	m     []int64
-	cur   int64
-	limit int64
+	mu        sync.Mutex
+	m         []int64
+	free      map[int64]struct{} // values in m
+	start     int64
+	cur       int64
+	limit     int64
+	allocated int64
+	wait      chan struct{} // closed when values may be available
 }
 
 // NewGenerator returns a new numeric identifier allocator. Start is the
 // starting value and limit is the upper limit.
 func NewGenerator(start int64, limit int64) *Generator {
-	return &Generator{cur: start, limit: limit}
+	return &Generator{cur: start, start: start, limit: limit}
 }
 
 // Get gets a value from the pool.
 func (g *Generator) Get() (int64, bool) {
 	g.mu.Lock()
+	v, ok := g.get()
+	g.mu.Unlock()
+	return v, ok
+}
+
+// get gets a value from the pool. g.mu must be held.
+func (g *Generator) get() (int64, bool) {
 	if len(g.m) > 0 {
 		v := g.m[len(g.m)-1]
 		g.m = g.m[:len(g.m)-1]
-		g.mu.Unlock()
+		delete(g.free, v)
+		g.allocated++
 		return v, true
 	}
-	if g.cur == g.limit {
-		g.mu.Unlock()
+	if g.cur >= g.limit {
 		return 0, false
 	}
 	v := g.cur
 	g.cur++
-	g.mu.Unlock()
+	g.allocated++
 	return v, true
 }
 
-// Put returns the value to the pool.
-func (g *Generator) Put(v int64) {
+// GetWait gets a value from the pool. If no value is available, GetWait
+// blocks until a value is returned by Put or the limit is raised by
+// SetLimit. If ctx is done before a value becomes available, GetWait
+// returns ctx.Err().
+func (g *Generator) GetWait(ctx context.Context) (int64, error) {
+	for {
+		g.mu.Lock()
+		if v, ok := g.get(); ok {
+			g.mu.Unlock()
+			return v, nil
+		}
+		if g.wait == nil {
+			g.wait = make(chan struct{})
+		}
+		wait := g.wait
+		g.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// notify wakes up all goroutines blocked in GetWait. g.mu must be held.
+func (g *Generator) notify() {
+	if g.wait != nil {
+		close(g.wait)
+		g.wait = nil
+	}
+}
+
+// Put returns the value to the pool. It reports whether v was accepted;
+// values that were never allocated or that are already returned are
+// ignored.
+func (g *Generator) Put(v int64) bool {
 	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if v < g.start || v >= g.cur {
+		return false
+	}
+	if _, found := g.free[v]; found {
+		return false
+	}
+	if g.free == nil {
+		g.free = make(map[int64]struct{})
+	}
 	g.m = append(g.m, v)
+	g.free[v] = struct{}{}
+	g.notify()
+	return true
+}
+
+// InUse returns the number of values allocated and not yet returned.
+func (g *Generator) InUse() int64 {
+	g.mu.Lock()
+	n := g.inUse()
+	g.mu.Unlock()
+	return n
+}
+
+// inUse returns the number of values in use. g.mu must be held.
+func (g *Generator) inUse() int64 {
+	return g.cur - g.start - int64(len(g.m))
+}
+
+// Available returns the number of values that can be allocated without
+// exceeding the upper limit, including returned values.
+func (g *Generator) Available() int64 {
+	g.mu.Lock()
+	n := g.available()
+	g.mu.Unlock()
+	return n
+}
+
+// available returns the number of available values. g.mu must be held.
+func (g *Generator) available() int64 {
+	n := int64(len(g.m))
+	if g.limit > g.cur {
+		n += g.limit - g.cur
+	}
+	return n
+}
+
+// Reset returns all allocated values to the pool at once, including
+// reserved blocks. Values handed out before Reset must not be returned
+// afterwards.
+func (g *Generator) Reset() {
+	g.mu.Lock()
+	g.m = nil
+	g.free = nil
+	g.cur = g.start
+	g.notify()
+	g.mu.Unlock()
+}
+
+// SetLimit sets the upper limit of g. Raising the limit allows further
+// values to be allocated. Lowering it below the values already handed
+// out keeps them valid but prevents new values from being allocated.
+func (g *Generator) SetLimit(limit int64) {
+	g.mu.Lock()
+	g.limit = limit
+	g.notify()
+	g.mu.Unlock()
+}
+
+// Allocated returns the total number of values handed out by Get,
+// including recycled ones.
+func (g *Generator) Allocated() int64 {
+	g.mu.Lock()
+	n := g.allocated
+	g.mu.Unlock()
+	return n
+}
+
+// String returns a description of the usage statistics of g.
+func (g *Generator) String() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return fmt.Sprintf("Generator(inuse=%d, available=%d, allocated=%d)",
+		g.inUse(), g.available(), g.allocated)
+}
+
+// ReserveBlock allocates n contiguous values and returns the first one.
+// The reserved values are never returned by Get. ReserveBlock fails if
+// the block would exceed the upper limit.
+func (g *Generator) ReserveBlock(n int64) (int64, bool) {
+	g.mu.Lock()
+	if n <= 0 || n > g.limit-g.cur {
+		g.mu.Unlock()
+		return 0, false
+	}
+	start := g.cur
+	g.cur += n
+	g.allocated += n
+	g.mu.Unlock()
+	return start, true
+}
+
+// Compact releases unused capacity of the list of returned values if it
+// uses less than a quarter of its capacity. It is intended to be called
+// after a burst of returned values has been reused.
+func (g *Generator) Compact() {
+	g.mu.Lock()
+	if cap(g.m) > 4*len(g.m) {
+		var m []int64
+		var free map[int64]struct{}
+		if len(g.m) > 0 {
+			m = make([]int64, len(g.m), 2*len(g.m))
+			copy(m, g.m)
+			// Maps never shrink, so the set is rebuilt as well.
+			free = make(map[int64]struct{}, len(g.m))
+			for _, v := range g.m {
+				free[v] = struct{}{}
+			}
+		}
+		g.m = m
+		g.free = free
+	}
 	g.mu.Unlock()
 }
@@ -1,6 +1,10 @@
 package pool
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+)
 
 func TestGeneratorLimit(t *testing.T) {
 	p := NewGenerator(1, 1000)
@@ -41,3 +45,194 @@ func TestGeneratorRecycle(t *testing.T) {
 		t.Fatalf("generator: pool not recycled values")
 	}
 }
+
+func TestGeneratorSetLimit(t *testing.T) {
+	p := NewGenerator(1, 3)
+	v1, _ := p.Get()
+	v2, _ := p.Get()
+	if _, ok := p.Get(); ok {
+		t.Fatalf("generator: not exhausted when it should be")
+	}
+
+	p.SetLimit(4)
+	if v, ok := p.Get(); !ok || v != 3 {
+		t.Fatalf("generator: expected value 3 after raising limit, got %d (%v)", v, ok)
+	}
+
+	p.SetLimit(2)
+	if _, ok := p.Get(); ok {
+		t.Fatalf("generator: not exhausted after lowering limit")
+	}
+	p.Put(v2)
+	if v, ok := p.Get(); !ok || v != v2 {
+		t.Fatalf("generator: expected recycled value %d, got %d (%v)", v2, v, ok)
+	}
+	p.Put(v1)
+	if v, ok := p.Get(); !ok || v != v1 {
+		t.Fatalf("generator: expected recycled value %d, got %d (%v)", v1, v, ok)
+	}
+}
+
+func TestGeneratorAllocated(t *testing.T) {
+	p := NewGenerator(1, 3)
+	v, _ := p.Get()
+	p.Put(v)
+	p.Get()
+	p.Get()
+	if _, ok := p.Get(); ok {
+		t.Fatalf("generator: not exhausted when it should be")
+	}
+
+	if n := p.Allocated(); n != 3 {
+		t.Fatalf("generator: expected 3 allocated values, got %d", n)
+	}
+}
+
+func TestGeneratorReserveBlock(t *testing.T) {
+	p := NewGenerator(1, 16)
+	v, _ := p.Get()
+
+	start, ok := p.ReserveBlock(10)
+	if !ok || start != v+1 {
+		t.Fatalf("generator: expected block starting at %d, got %d (%v)", v+1, start, ok)
+	}
+	if _, ok = p.ReserveBlock(5); ok {
+		t.Fatalf("generator: block exceeding the limit reserved")
+	}
+	if _, ok = p.ReserveBlock(0); ok {
+		t.Fatalf("generator: empty block reserved")
+	}
+
+	for {
+		v, ok := p.Get()
+		if !ok {
+			break
+		}
+		if v >= start && v < start+10 {
+			t.Fatalf("generator: reserved value %d handed out", v)
+		}
+	}
+	if n := p.Allocated(); n != 15 {
+		t.Fatalf("generator: expected 15 allocated values, got %d", n)
+	}
+}
+
+func TestGeneratorCompact(t *testing.T) {
+	p := NewGenerator(0, 1024)
+	for i := 0; i < 1024; i++ {
+		p.Get()
+	}
+	for i := int64(0); i < 1024; i++ {
+		p.Put(i)
+	}
+	for i := 0; i < 1000; i++ {
+		p.Get()
+	}
+
+	p.Compact()
+	if len(p.m) != 24 || cap(p.m) != 48 {
+		t.Fatalf("generator: expected length 24 and capacity 48, got %d and %d", len(p.m), cap(p.m))
+	}
+	if len(p.free) != 24 {
+		t.Fatalf("generator: expected 24 returned values, got %d", len(p.free))
+	}
+	if v := p.m[0]; p.Put(v) {
+		t.Fatalf("generator: accepted returned value %d twice after compaction", v)
+	}
+	for i := 0; i < 24; i++ {
+		p.Get()
+	}
+	p.Compact()
+	if p.m != nil || p.free != nil {
+		t.Fatalf("generator: expected released free list and set, got capacity %d and %d values", cap(p.m), len(p.free))
+	}
+	if !p.Put(0) {
+		t.Fatalf("generator: value not accepted after compaction")
+	}
+}
+
+func TestGeneratorGetWait(t *testing.T) {
+	p := NewGenerator(1, 2)
+	v, err := p.GetWait(context.Background())
+	if err != nil || v != 1 {
+		t.Fatalf("generator: expected value 1, got (%d, %v)", v, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetWait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("generator: expected deadline exceeded, got %v", err)
+	}
+
+	done := make(chan int64)
+	go func() {
+		v, _ := p.GetWait(context.Background())
+		done <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	p.Put(v)
+	if v := <-done; v != 1 {
+		t.Fatalf("generator: expected recycled value 1, got %d", v)
+	}
+
+	go func() {
+		v, _ := p.GetWait(context.Background())
+		done <- v
+	}()
+	p.SetLimit(3)
+	if v := <-done; v != 2 {
+		t.Fatalf("generator: expected value 2 after raising the limit, got %d", v)
+	}
+}
+
+func TestGeneratorStats(t *testing.T) {
+	p := NewGenerator(10, 20)
+	v1, _ := p.Get()
+	v2, _ := p.Get()
+	p.Get()
+	if n := p.InUse(); n != 3 {
+		t.Fatalf("generator: expected 3 values in use, got %d", n)
+	}
+	if n := p.Available(); n != 7 {
+		t.Fatalf("generator: expected 7 available values, got %d", n)
+	}
+
+	if !p.Put(v1) || !p.Put(v2) {
+		t.Fatalf("generator: allocated values not accepted")
+	}
+	for _, v := range []int64{v1, 9, 13, 20} {
+		if p.Put(v) {
+			t.Fatalf("generator: accepted invalid value %d", v)
+		}
+	}
+	if n := p.InUse(); n != 1 {
+		t.Fatalf("generator: expected 1 value in use, got %d", n)
+	}
+	if n := p.Available(); n != 9 {
+		t.Fatalf("generator: expected 9 available values, got %d", n)
+	}
+
+	p.Reset()
+	if n, m := p.InUse(), p.Available(); n != 0 || m != 10 {
+		t.Fatalf("generator: expected 0 in use and 10 available after reset, got %d and %d", n, m)
+	}
+	if v, _ := p.Get(); v != 10 {
+		t.Fatalf("generator: expected start value 10 after reset, got %d", v)
+	}
+}
+
+func TestGeneratorZeroValue(t *testing.T) {
+	var p Generator
+	p.SetLimit(10)
+	v, ok := p.Get()
+	if !ok || v != 0 {
+		t.Fatalf("generator: expected value 0, got (%d, %v)", v, ok)
+	}
+	if !p.Put(v) || p.Put(v) {
+		t.Fatalf("generator: expected value to be accepted exactly once")
+	}
+	p.Reset()
+	if v, _ := p.Get(); !p.Put(v) {
+		t.Fatalf("generator: value not accepted after reset")
+	}
+}
@@ -2,7 +2,14 @@
 // lists.
 package pool
 
-import "github.com/azmodb/pkg/log"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/azmodb/pkg/log"
+)
 
 // LimitPool is a set of temporary objects that may be individually saved
 // and retrieved.
@@ -10,49 +17,212 @@ import "github.com/azmodb/pkg/log"
 // LimitPool's purpose is to cache up to Limit allocated but unused
 // values for later reuse. That is, it makes it easy to build efficient
 // and memory limited, thread-safe free lists.
+//
+// If Validate is set, it is called on each cached value before Get
+// returns it. Values for which Validate returns false are discarded.
+//
+// If Destructor is set, it is called on each value the pool discards:
+// values rejected by Validate, values that do not fit into the cache and
+// cached values released by Close.
 type LimitPool struct {
-	Factory func() interface{}
-	Limit   int
+	Factory    func() interface{}
+	Validate   func(interface{}) bool
+	Destructor func(interface{})
+	Limit      int
 
-	cache chan interface{}
+	mu     sync.RWMutex // protects cache, closed and Limit after first use
+	cache  chan interface{}
+	closed bool
 }
 
 // DefaultLimit is the default maximal cache size.
 const DefaultLimit = 8
 
-func (p *LimitPool) init() {
-	if p.cache == nil {
+// init allocates the cache on first use. It reports whether the pool is
+// still open.
+func (p *LimitPool) init() bool {
+	p.mu.RLock()
+	initialized, closed := p.cache != nil, p.closed
+	p.mu.RUnlock()
+	if initialized || closed {
+		return !closed
+	}
+
+	p.mu.Lock()
+	if p.cache == nil && !p.closed {
 		if p.Limit <= 0 {
 			p.Limit = DefaultLimit
 		}
 		p.cache = make(chan interface{}, p.Limit)
 	}
+	closed = p.closed
+	p.mu.Unlock()
+	return !closed
 }
 
-// Get selects an arbitrary value from the pool, removes it from the pool
-// and returns it to the caller.
-func (p *LimitPool) Get() (value interface{}) {
-	p.init()
-
+// tryGet removes a cached value from the pool, if any. It also reports
+// whether the pool is closed.
+func (p *LimitPool) tryGet() (value interface{}, ok, closed bool) {
+	p.mu.RLock()
 	select {
 	case value = <-p.cache:
+		ok = true
 	default:
-		if p.Factory == nil {
-			log.Panicf("pool: LimitPool factory function not set")
+	}
+	closed = p.closed
+	p.mu.RUnlock()
+	return value, ok, closed
+}
+
+// destroy calls Destructor on value, if set.
+func (p *LimitPool) destroy(value interface{}) {
+	if p.Destructor != nil {
+		p.Destructor(value)
+	}
+}
+
+// Get selects an arbitrary value from the pool, removes it from the pool
+// and returns it to the caller. Get panics if the pool is closed.
+func (p *LimitPool) Get() interface{} {
+	return p.GetWith(p.Factory)
+}
+
+// GetWith is like Get but calls factory instead of Factory if the pool
+// is empty. The returned value may be returned to the pool by Put.
+func (p *LimitPool) GetWith(factory func() interface{}) interface{} {
+	p.init()
+
+	for {
+		value, ok, closed := p.tryGet()
+		if closed {
+			log.Panicf("pool: LimitPool is closed")
+		}
+		if !ok {
+			break
+		}
+		if p.Validate == nil || p.Validate(value) {
+			return value
 		}
-		value = p.Factory()
+		p.destroy(value)
 	}
-	return value
+
+	if factory == nil {
+		log.Panicf("pool: LimitPool factory function not set")
+	}
+	return factory()
 }
 
-// Put returns the value to the pool.
+// Put returns the value to the pool. If the pool is full or closed, the
+// value is discarded.
 func (p *LimitPool) Put(value interface{}) {
 	p.init()
 
+	p.mu.RLock()
+	var cached bool
 	select {
 	case p.cache <- value:
+		cached = true
 	default:
 	}
+	p.mu.RUnlock()
+	if !cached {
+		p.destroy(value)
+	}
+}
+
+// Warmup fills the pool with up to n values created by Factory. The
+// number of cached values never exceeds Limit.
+func (p *LimitPool) Warmup(n int) {
+	if !p.init() {
+		return
+	}
+
+	if p.Factory == nil {
+		log.Panicf("pool: LimitPool factory function not set")
+	}
+	p.mu.RLock()
+	free := cap(p.cache) - len(p.cache)
+	p.mu.RUnlock()
+	if n > free {
+		n = free
+	}
+	for i := 0; i < n; i++ {
+		p.Put(p.Factory())
+	}
+}
+
+// SetLimit changes the maximal cache size of the pool to n. Cached values
+// are kept as far as they fit into the new limit; the others are
+// discarded. A value of n <= 0 sets DefaultLimit.
+func (p *LimitPool) SetLimit(n int) {
+	if n <= 0 {
+		n = DefaultLimit
+	}
+
+	p.mu.Lock()
+	p.Limit = n
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	cache := make(chan interface{}, n)
+	var dropped []interface{}
+	if p.cache != nil {
+		close(p.cache)
+		for value := range p.cache {
+			select {
+			case cache <- value:
+			default:
+				dropped = append(dropped, value)
+			}
+		}
+	}
+	p.cache = cache
+	p.mu.Unlock()
+
+	for _, value := range dropped {
+		p.destroy(value)
+	}
+}
+
+// Len returns the number of cached values.
+func (p *LimitPool) Len() int {
+	p.mu.RLock()
+	n := len(p.cache)
+	p.mu.RUnlock()
+	return n
+}
+
+// String returns a description of the state of the pool.
+func (p *LimitPool) String() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return "LimitPool(closed)"
+	}
+	limit := p.Limit
+	if limit <= 0 {
+		limit = DefaultLimit // not yet initialized
+	}
+	return fmt.Sprintf("LimitPool(limit=%d, cached=%d)", limit, len(p.cache))
+}
+
+// Close discards all cached values. After Close, Get panics and Put
+// discards its value. Close may be called more than once.
+func (p *LimitPool) Close() {
+	p.mu.Lock()
+	cache := p.cache
+	p.cache = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	if cache == nil {
+		return
+	}
+	close(cache)
+	for value := range cache {
+		p.destroy(value)
+	}
 }
 
 // Pool represents a set of temporary objects that may be individually
@@ -71,13 +241,36 @@ type Pool interface {
 // Map represents a Pool registry.
 type Map map[interface{}]Pool
 
+// defaultKey is the key of the default pool of a Map.
+type defaultKey struct{}
+
+// SetDefault sets the pool used for keys that have no registered pool.
+// The default pool is stored in m and counts towards its length. A nil
+// pool removes the default pool.
+func (m Map) SetDefault(pool Pool) {
+	if pool == nil {
+		delete(m, defaultKey{})
+		return
+	}
+	m[defaultKey{}] = pool
+}
+
+// lookup returns the pool registered for key or the default pool.
+func (m Map) lookup(key interface{}) (Pool, bool) {
+	if pool, found := m[key]; found {
+		return pool, true
+	}
+	pool, found := m[defaultKey{}]
+	return pool, found
+}
+
 // Get selects an arbitrary value from the Pool, removes it from
 // the Pool, and returns it to the caller.
 //
 // The success result indicates whether a pool was found in the pool
-// map.
+// map, either registered for key or set by SetDefault.
 func (m Map) Get(key interface{}) (interface{}, bool) {
-	pool, success := m[key]
+	pool, success := m.lookup(key)
 	if !success {
 		return nil, false
 	}
@@ -89,19 +282,46 @@ type Resetter interface {
 	Reset()
 }
 
+// Reset resets v if it implements Resetter. Otherwise it does nothing.
+func Reset(v interface{}) {
+	if r, ok := v.(Resetter); ok {
+		r.Reset()
+	}
+}
+
+// ResetOnGet returns a Pool that resets values implementing Resetter
+// when they are retrieved from pool. Registering a pool wrapped by
+// ResetOnGet guarantees clean values even if they were returned to pool
+// without being reset.
+func ResetOnGet(pool Pool) Pool {
+	return resetPool{pool}
+}
+
+type resetPool struct {
+	Pool
+}
+
+func (p resetPool) String() string {
+	return "ResetOnGet(" + describe(p.Pool) + ")"
+}
+
+func (p resetPool) Get() interface{} {
+	v := p.Pool.Get()
+	Reset(v)
+	return v
+}
+
 // Put returns the value to the pool. If value implements Resettter,
 // Put resets value.
 //
 // The success result indicates whether a pool was found in the pool
-// map.
+// map, either registered for key or set by SetDefault.
 func (m Map) Put(key interface{}, v interface{}) bool {
-	pool, success := m[key]
+	pool, success := m.lookup(key)
 	if !success {
 		return false
 	}
-	if r, ok := v.(Resetter); ok {
-		r.Reset()
-	}
+	Reset(v)
 	pool.Put(v)
 	return true
 }
@@ -116,3 +336,33 @@ func (m *Map) Register(key interface{}, pool Pool) {
 	}
 	(*m)[key] = pool
 }
+
+// Dump returns a description of the pools registered in m and of the
+// given generators, one line per key sorted by key. Pools implementing
+// fmt.Stringer, such as LimitPool, describe their state; other pools are
+// described by their type. Generators are described by their usage
+// statistics. Generators may be nil.
+func (m Map) Dump(generators map[string]*Generator) string {
+	lines := make([]string, 0, len(m)+len(generators))
+	for key, pool := range m {
+		name := fmt.Sprint(key)
+		if _, ok := key.(defaultKey); ok {
+			name = "<default>"
+		}
+		lines = append(lines, name+": "+describe(pool)+"\n")
+	}
+	for name, g := range generators {
+		lines = append(lines, name+": "+describe(g)+"\n")
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "")
+}
+
+// describe returns the state of v if it implements fmt.Stringer, such
+// as LimitPool and Generator, and its type otherwise.
+func describe(v interface{}) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", v)
+}
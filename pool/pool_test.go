@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"reflect"
 	"sync"
 	"testing"
 )
@@ -61,3 +62,257 @@ func testMapGetPut(t *testing.T, m Map) {
 		t.Fatalf("map: expected failure, got %v", ok)
 	}
 }
+
+func TestLimitPoolWarmup(t *testing.T) {
+	created := 0
+	p := &LimitPool{
+		Factory: func() interface{} { created++; return created },
+		Limit:   4,
+	}
+
+	p.Warmup(2)
+	if created != 2 || len(p.cache) != 2 {
+		t.Fatalf("warmup: expected 2 cached values, got %d (created %d)", len(p.cache), created)
+	}
+	p.Warmup(8)
+	if created != 4 || len(p.cache) != 4 {
+		t.Fatalf("warmup: expected 4 cached values, got %d (created %d)", len(p.cache), created)
+	}
+
+	for i := 0; i < 4; i++ {
+		p.Get()
+	}
+	if created != 4 {
+		t.Fatalf("warmup: expected cached values, factory called %d times", created)
+	}
+}
+
+type testValue4 struct{ n int } // testValue4 implements pool.Resetter
+
+func (v *testValue4) Reset() { *v = testValue4{} }
+
+func TestResetOnGet(t *testing.T) {
+	pool := &LimitPool{Factory: func() interface{} { return &testValue4{} }}
+
+	m := make(Map)
+	m.Register(1, ResetOnGet(pool))
+
+	pool.Put(&testValue4{n: 42}) // bypasses Map.Put
+	v, ok := m.Get(1)
+	if !ok {
+		t.Fatalf("map: testValue4 pool not found")
+	}
+	if v.(*testValue4).n != 0 {
+		t.Fatalf("map: expected reset value, got %+v", v)
+	}
+}
+
+func TestLimitPoolValidate(t *testing.T) {
+	p := &LimitPool{
+		Factory:  func() interface{} { return 0 },
+		Validate: func(v interface{}) bool { return v.(int) > 1 },
+		Limit:    4,
+	}
+	p.Put(3)
+	p.Put(1)
+	p.Put(2)
+	p.Put(1)
+
+	for i, want := range []int{3, 2, 0} {
+		if v := p.Get().(int); v != want {
+			t.Fatalf("validate (%.4d): expected value %d, got %d", i, want, v)
+		}
+	}
+	if len(p.cache) != 0 {
+		t.Fatalf("validate: expected empty cache, got %d", len(p.cache))
+	}
+}
+
+func TestMapDefault(t *testing.T) {
+	pool1 := &LimitPool{Factory: func() interface{} { return &testValue1{} }}
+	pool2 := &LimitPool{Factory: func() interface{} { return &testValue2{} }}
+
+	m := make(Map)
+	m.Register(1, pool1)
+	m.SetDefault(pool2)
+
+	if v, ok := m.Get(1); !ok || v.(*testValue1) == nil {
+		t.Fatalf("map: expected testValue1, got %T (%v)", v, ok)
+	}
+	v, ok := m.Get(42)
+	if !ok {
+		t.Fatalf("map: expected default pool")
+	}
+	if _, ok = v.(*testValue2); !ok {
+		t.Fatalf("map: expected testValue2, got %T", v)
+	}
+	if ok = m.Put(42, v); !ok || len(pool2.cache) != 1 {
+		t.Fatalf("map: expected value returned to default pool")
+	}
+
+	m.SetDefault(nil)
+	if _, ok = m.Get(42); ok {
+		t.Fatalf("map: expected failure after removing default pool")
+	}
+}
+
+func TestReset(t *testing.T) {
+	v := &testValue4{n: 42}
+	Reset(v)
+	if v.n != 0 {
+		t.Fatalf("reset: expected reset value, got %+v", v)
+	}
+	Reset(&testValue2{}) // no-op
+	Reset(nil)
+}
+
+func TestLimitPoolSetLimit(t *testing.T) {
+	p := &LimitPool{Factory: func() interface{} { return 0 }, Limit: 4}
+	for i := 1; i <= 4; i++ {
+		p.Put(i)
+	}
+
+	p.SetLimit(2)
+	if p.Limit != 2 || cap(p.cache) != 2 || len(p.cache) != 2 {
+		t.Fatalf("setlimit: expected 2 of 2 cached values, got %d of %d", len(p.cache), cap(p.cache))
+	}
+	if v1, v2 := p.Get(), p.Get(); v1 != 1 || v2 != 2 {
+		t.Fatalf("setlimit: expected migrated values 1 and 2, got %v and %v", v1, v2)
+	}
+
+	p.SetLimit(8)
+	p.Warmup(16)
+	if len(p.cache) != 8 {
+		t.Fatalf("setlimit: expected 8 cached values, got %d", len(p.cache))
+	}
+
+	var q LimitPool
+	q.SetLimit(3)
+	q.Put(1)
+	if q.Limit != 3 || len(q.cache) != 1 {
+		t.Fatalf("setlimit: expected unused pool to be resized")
+	}
+}
+
+func TestLimitPoolConcurrent(t *testing.T) {
+	p := &LimitPool{Factory: func() interface{} { return 0 }}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.Put(p.Get())
+				if j%10 == 0 {
+					p.SetLimit(i + j%7)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestLimitPoolGetWith(t *testing.T) {
+	p := &LimitPool{Factory: func() interface{} { return 1 }}
+	large := func() interface{} { return 2 }
+
+	if v := p.GetWith(large); v != 2 {
+		t.Fatalf("getwith: expected custom value 2, got %v", v)
+	}
+	p.Put(3)
+	if v := p.GetWith(large); v != 3 {
+		t.Fatalf("getwith: expected cached value 3, got %v", v)
+	}
+	if v := p.Get(); v != 1 {
+		t.Fatalf("getwith: expected default value 1, got %v", v)
+	}
+}
+
+func TestLimitPoolClose(t *testing.T) {
+	var destroyed []interface{}
+	p := &LimitPool{
+		Factory:    func() interface{} { return 0 },
+		Destructor: func(v interface{}) { destroyed = append(destroyed, v) },
+		Limit:      2,
+	}
+	for i := 1; i <= 4; i++ {
+		p.Put(i)
+	}
+	if !reflect.DeepEqual(destroyed, []interface{}{3, 4}) {
+		t.Fatalf("close: expected evicted values [3 4], got %v", destroyed)
+	}
+
+	p.Close()
+	p.Close()
+	if !reflect.DeepEqual(destroyed, []interface{}{3, 4, 1, 2}) {
+		t.Fatalf("close: expected drained values [3 4 1 2], got %v", destroyed)
+	}
+	p.Put(5)
+	if len(destroyed) != 5 || destroyed[4] != 5 {
+		t.Fatalf("close: expected value put after close to be destroyed, got %v", destroyed)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("close: expected Get to panic on closed pool")
+		}
+	}()
+	p.Get()
+}
+
+func TestLimitPoolCloseUnused(t *testing.T) {
+	var p LimitPool
+	p.Close()
+	p.Warmup(4)
+	p.Put(1)
+}
+
+func TestMapDump(t *testing.T) {
+	limited := &LimitPool{Factory: func() interface{} { return 0 }, Limit: 4}
+	limited.Put(1)
+	closed := &LimitPool{}
+	closed.Close()
+
+	m := make(Map)
+	m.Register("a", limited)
+	m.Register("b", ResetOnGet(closed))
+	m.Register("c", &sync.Pool{})
+	m.SetDefault(&LimitPool{})
+
+	g := NewGenerator(1, 10)
+	g.Get()
+	v, _ := g.Get()
+	g.Put(v)
+
+	want := "<default>: LimitPool(limit=8, cached=0)\n" +
+		"a: LimitPool(limit=4, cached=1)\n" +
+		"b: ResetOnGet(LimitPool(closed))\n" +
+		"c: *sync.Pool\n" +
+		"fids: Generator(inuse=1, available=8, allocated=2)\n"
+	if got := m.Dump(map[string]*Generator{"fids": g}); got != want {
+		t.Fatalf("dump: expected\n%s\ngot\n%s", want, got)
+	}
+	if n := limited.Len(); n != 1 {
+		t.Fatalf("dump: expected 1 cached value, got %d", n)
+	}
+	if got := make(Map).Dump(nil); got != "" {
+		t.Fatalf("dump: expected empty dump, got %q", got)
+	}
+}
+
+func TestLimitPoolCloseDuringGet(t *testing.T) {
+	p := &LimitPool{Factory: func() interface{} { return 0 }}
+	p.Validate = func(interface{}) bool {
+		p.Close() // closes the pool between two cache lookups
+		return false
+	}
+	p.Put(1)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("close: expected Get to panic when the pool is closed concurrently")
+		}
+	}()
+	p.Get()
+}
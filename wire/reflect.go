@@ -3,32 +3,90 @@ package wire
 import (
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"time"
 )
 
+// FieldError describes a failure to decode a nested value. Path names the
+// struct fields and slice indexes leading to the value, for example
+// "Body.Entries[3].Name".
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("wire: %v decoding %s", e.Err, e.Path)
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// fieldError prepends elem to the path of err. Paths are built while
+// unwinding so that successful decodes do not pay for them.
+func fieldError(err error, elem string) error {
+	fe, ok := err.(*FieldError)
+	if !ok {
+		return &FieldError{Path: elem, Err: err}
+	}
+	if fe.Path != "" && fe.Path[0] != '[' {
+		elem += "."
+	}
+	fe.Path = elem + fe.Path
+	return fe
+}
+
 // Unmarshal parses a wire-format message in b and places the decoded results
-// in args.
+// in args. If a nested value cannot be decoded, the returned error is a
+// *FieldError identifying the value. If b already holds an error,
+// Unmarshal returns it without decoding.
 func (b *Buffer) Unmarshal(args ...interface{}) error {
+	if err := b.Err(); err != nil {
+		return err
+	}
+
 	var err error
 	for i := 0; i < len(args) && err == nil; i++ {
 		v := reflect.ValueOf(args[i])
+		if v.Kind() == reflect.Invalid {
+			return errors.New("cannot decode <nil> value")
+		}
 		if v.Kind() != reflect.Ptr {
-			return fmt.Errorf("arg of type %q must be a pointer", v.Type())
+			return fmt.Errorf("cannot decode into non-pointer type %q, pass &v instead of v", v.Type())
 		}
-		if v.Kind() == reflect.Ptr && v.IsNil() {
+		if v.IsNil() {
 			return fmt.Errorf("cannot decode <nil> pointer %q", v.Type())
 		}
-		if v.Kind() == reflect.Invalid {
-			return errors.New("cannot decode <nil> value")
-		}
 		v = v.Elem()
-		err = b.unmarshalType(v)
+		if b.decodeHook == nil {
+			err = b.unmarshalType(v, b.shortStructs)
+			continue
+		}
+		start := time.Now()
+		if err = b.unmarshalType(v, b.shortStructs); err == nil {
+			b.decodeHook(v.Type(), time.Since(start))
+		}
+	}
+	if err != nil && (b.err == nil || errors.Is(err, b.err)) {
+		b.err = err // keep the field path
 	}
-	b.setErr(err)
 	return b.Err()
 }
 
-func (b *Buffer) unmarshalType(v reflect.Value) (err error) {
+// durationType is encoded as a little-endian uint64 of nanoseconds,
+// independent of its underlying type.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// unmarshalType decodes v from b. If short is set and v is a struct, the
+// data may end after any of its fields; the remaining fields are left
+// unchanged.
+func (b *Buffer) unmarshalType(v reflect.Value, short bool) (err error) {
+	if v.Type() == durationType {
+		v.SetInt(int64(b.Uint64()))
+		return b.Err()
+	}
+
 	switch v.Kind() {
 	default:
 		err = fmt.Errorf("cannot decode type %q", v.Type())
@@ -39,22 +97,84 @@ func (b *Buffer) unmarshalType(v reflect.Value) (err error) {
 			v.SetBytes(b.Bytes())
 		case reflect.String, reflect.Struct:
 			size := int(b.Uint16())
-			elemType := v.Type().Elem()
+			if err = b.Err(); err != nil || size == 0 {
+				break
+			}
+			// Decode in place after any existing elements, so that
+			// elements are appended as before without allocating
+			// each one separately. The count is untrusted, so no more
+			// elements are preallocated than the remaining data can
+			// hold; the slice grows if that estimate is exceeded.
+			elem := v.Type().Elem()
+			prealloc := size
+			if min := minSize(elem); min > 0 && prealloc > len(b.data)/min {
+				prealloc = len(b.data) / min
+			}
+			n := v.Len()
+			slice := reflect.New(v.Type()).Elem() // addressable for SetLen
+			slice.Set(reflect.MakeSlice(v.Type(), n, n+prealloc))
+			reflect.Copy(slice, v)
 			for i := 0; i < size; i++ {
-				obj := reflect.New(elemType)
-				if err = b.unmarshalType(obj.Elem()); err != nil {
+				if slice.Len() < slice.Cap() {
+					slice.SetLen(n + i + 1)
+				} else {
+					slice.Set(reflect.Append(slice, reflect.Zero(elem)))
+				}
+				if err = b.unmarshalType(slice.Index(n+i), false); err != nil {
+					err = fieldError(err, fmt.Sprintf("[%d]", i))
+					slice.SetLen(n + i)
 					break
 				}
-				v.Set(reflect.Append(v, obj.Elem()))
 			}
-		case reflect.Ptr:
-			panic("decode: pointer to slices not supported")
+			v.Set(slice)
+		default:
+			err = fmt.Errorf("cannot decode type %q", v.Type())
 		}
 
+	case reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			err = fmt.Errorf("cannot decode type %q", v.Type())
+			break
+		}
+		if err = b.Err(); err != nil {
+			break
+		}
+		data, n := ConsumeRaw(b.data, v.Len())
+		if n < 0 {
+			err = ParseError(n)
+			break
+		}
+		reflect.Copy(v, reflect.ValueOf(data))
+		b.data = b.data[n:]
+
 	case reflect.Struct:
+		avail := len(b.data) // an empty message is never short
 		fields := v.NumField()
 		for i := 0; i < fields; i++ {
-			if err = b.unmarshalType(v.Field(i)); err != nil {
+			if short && avail > 0 && len(b.data) == 0 {
+				break
+			}
+			if isSkipped(v.Type(), i) {
+				continue
+			}
+			if n := bitFields(v.Type(), i); n > 0 {
+				if err = b.unmarshalBits(v, i, n); err != nil {
+					err = fieldError(err, v.Type().Field(i).Name)
+					break
+				}
+				i += n - 1
+				continue
+			}
+			if isOptional(v.Type(), i) {
+				v.Field(i).SetBytes(b.OptionalBytes())
+				if err = b.Err(); err != nil {
+					err = fieldError(err, v.Type().Field(i).Name)
+					break
+				}
+				continue
+			}
+			if err = b.unmarshalType(v.Field(i), false); err != nil {
+				err = fieldError(err, v.Type().Field(i).Name)
 				break
 			}
 		}
@@ -69,11 +189,266 @@ func (b *Buffer) unmarshalType(v reflect.Value) (err error) {
 		v.SetUint(uint64(b.Uint16()))
 	case reflect.Uint8:
 		v.SetUint(uint64(b.Uint8()))
+	case reflect.Int64:
+		v.SetInt(int64(b.Uint64()))
+	case reflect.Int32:
+		v.SetInt(int64(int32(b.Uint32())))
+	case reflect.Int16:
+		v.SetInt(int64(int16(b.Uint16())))
+	case reflect.Int8:
+		v.SetInt(int64(int8(b.Uint8())))
+	case reflect.Bool:
+		switch u := b.Uint8(); u {
+		case 0, 1:
+			v.SetBool(u == 1)
+		default:
+			err = fmt.Errorf("cannot decode bool value %d", u)
+		}
+	}
+	if err == nil {
+		err = b.Err()
+	}
+	return err
+}
+
+// RangeStructs decodes the 16-bit count of a list of values of the same
+// type as template and calls fn once per element with a Buffer scoped to
+// exactly that element. Elements that fn does not fully decode are
+// skipped. If fn returns an error, RangeStructs stops and returns it.
+func (b *Buffer) RangeStructs(template interface{}, fn func(*Buffer) error) error {
+	t := reflect.TypeOf(template)
+	if t == nil {
+		return errors.New("cannot range over <nil> value")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	n := int(b.Uint16())
+	for i := 0; i < n && b.Err() == nil; i++ {
+		next := *b
+		next.setErr(next.skipType(t))
+		if err := next.Err(); err != nil {
+			b.setErr(fieldError(err, fmt.Sprintf("[%d]", i)))
+			break
+		}
+
+		elem := *b
+		elem.data = b.data[: len(b.data)-len(next.data) : len(b.data)-len(next.data)]
+		elem.peak = len(elem.data)
+		b.data = next.data
+		if err := fn(&elem); err != nil {
+			return err
+		}
+	}
+	return b.Err()
+}
+
+// DecodeFixedSlice decodes count consecutive values into dst[:count] in
+// place. Dst must be a slice, or a pointer to a slice, with at least count
+// elements of a fixed-size type: an integer, a bool, a byte array or a
+// struct of fixed-size fields. Unlike Unmarshal, no count is read from b.
+func (b *Buffer) DecodeFixedSlice(dst interface{}, count int) error {
+	v := reflect.Indirect(reflect.ValueOf(dst))
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot decode into non-slice type %T", dst)
+	}
+	size, ok := fixedSize(v.Type().Elem())
+	if !ok {
+		return fmt.Errorf("cannot decode variable-size type %q", v.Type().Elem())
+	}
+	if count < 0 || count > v.Len() {
+		return fmt.Errorf("cannot decode %d values into slice of length %d", count, v.Len())
+	}
+	if b.Err() != nil {
+		return b.Err()
+	}
+	if count*size > len(b.data) {
+		b.setErr(io.ErrUnexpectedEOF)
+		return b.Err()
+	}
+
+	for i := 0; i < count; i++ {
+		if err := b.unmarshalType(v.Index(i), false); err != nil {
+			err = fieldError(err, fmt.Sprintf("[%d]", i))
+			if b.err == nil || errors.Is(err, b.err) {
+				b.err = err // keep the field path, as Unmarshal does
+			}
+			return b.Err()
+		}
+	}
+	return nil
+}
+
+// fixedSize returns the encoded size of t and whether all values of t
+// have that size.
+func fixedSize(t reflect.Type) (n int, ok bool) {
+	if t == durationType {
+		return 8, true
+	}
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len(), t.Elem().Kind() == reflect.Uint8
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if isSkipped(t, i) {
+				continue
+			}
+			if bits := bitFields(t, i); bits > 0 {
+				n += (bits + 7) / 8
+				i += bits - 1
+				continue
+			}
+			if isOptional(t, i) {
+				return 0, false
+			}
+			size, ok := fixedSize(t.Field(i).Type)
+			if !ok {
+				return 0, false
+			}
+			n += size
+		}
+		return n, true
+	case reflect.Uint64, reflect.Int64:
+		return 8, true
+	case reflect.Uint32, reflect.Int32:
+		return 4, true
+	case reflect.Uint16, reflect.Int16:
+		return 2, true
+	case reflect.Uint8, reflect.Int8, reflect.Bool:
+		return 1, true
+	}
+	return 0, false
+}
+
+// minSize returns the smallest encoded size of a value of type t.
+func minSize(t reflect.Type) (n int) {
+	if size, ok := fixedSize(t); ok {
+		return size
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return 4
+		}
+		return 2
+	case reflect.String:
+		return 2
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if isSkipped(t, i) {
+				continue
+			}
+			if bits := bitFields(t, i); bits > 0 {
+				n += (bits + 7) / 8
+				i += bits - 1
+				continue
+			}
+			if isOptional(t, i) {
+				n++
+				continue
+			}
+			n += minSize(t.Field(i).Type)
+		}
+	}
+	return n
+}
+
+// SkipType advances b past a wire-format encoded value of the same type
+// as template without decoding it. Template may be a value or a pointer.
+func (b *Buffer) SkipType(template interface{}) error {
+	t := reflect.TypeOf(template)
+	if t == nil {
+		return errors.New("cannot skip <nil> value")
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	b.setErr(b.skipType(t))
+	return b.Err()
+}
+
+func (b *Buffer) skipType(t reflect.Type) (err error) {
+	if t == durationType {
+		b.skip(8)
+		return nil
+	}
+
+	switch t.Kind() {
+	default:
+		err = fmt.Errorf("cannot skip type %q", t)
+
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.Uint8:
+			b.skip(int(b.Uint32()))
+		case reflect.String, reflect.Struct:
+			size := int(b.Uint16())
+			for i := 0; i < size && b.Err() == nil; i++ {
+				if err = b.skipType(t.Elem()); err != nil {
+					break
+				}
+			}
+		default:
+			err = fmt.Errorf("cannot skip type %q", t)
+		}
+
+	case reflect.Array:
+		if t.Elem().Kind() != reflect.Uint8 {
+			err = fmt.Errorf("cannot skip type %q", t)
+			break
+		}
+		b.skip(t.Len())
+
+	case reflect.Struct:
+		fields := t.NumField()
+		for i := 0; i < fields; i++ {
+			if isSkipped(t, i) {
+				continue
+			}
+			if n := bitFields(t, i); n > 0 {
+				b.skip((n + 7) / 8)
+				i += n - 1
+				continue
+			}
+			if isOptional(t, i) {
+				if b.Uint8() != 0 {
+					b.skip(int(b.Uint32()))
+				}
+				continue
+			}
+			if err = b.skipType(t.Field(i).Type); err != nil {
+				break
+			}
+		}
+
+	case reflect.String:
+		b.skip(int(b.Uint16()))
+	case reflect.Uint64, reflect.Int64:
+		b.skip(8)
+	case reflect.Uint32, reflect.Int32:
+		b.skip(4)
+	case reflect.Uint16, reflect.Int16:
+		b.skip(2)
+	case reflect.Uint8, reflect.Int8, reflect.Bool:
+		b.skip(1)
 	}
 	return err
 }
 
 // Marshal returns the wire-format encoding of args.
+//
+// Signed integers are encoded like unsigned integers of the same width.
+// Values of type time.Duration are encoded as 64-bit nanoseconds.
+// Bool values are encoded as a single byte, 0 or 1. Byte arrays are
+// encoded as their raw bytes without a length prefix; other arrays are
+// not supported.
+//
+// Unexported struct fields and fields tagged `wire:"-"` are skipped.
+//
+// Consecutive bool struct fields tagged `wire:"bit"` are packed into
+// shared bytes, least significant bit first. []byte struct fields tagged
+// `wire:"optional"` are encoded as by PutOptionalBytes.
 func (b *Buffer) Marshal(args ...interface{}) error {
 	var err error
 	for i := 0; i < len(args) && err == nil; i++ {
@@ -94,6 +469,11 @@ func (b *Buffer) Marshal(args ...interface{}) error {
 }
 
 func (b *Buffer) marshalType(v reflect.Value) (err error) {
+	if v.Type() == durationType {
+		b.PutUint64(uint64(v.Int()))
+		return nil
+	}
+
 	switch v.Kind() {
 	default:
 		err = fmt.Errorf("cannot encode type %q", v.Type())
@@ -110,13 +490,40 @@ func (b *Buffer) marshalType(v reflect.Value) (err error) {
 					break
 				}
 			}
-		case reflect.Ptr:
-			panic("encode: pointer to slices not supported")
+		default:
+			err = fmt.Errorf("cannot encode type %q", v.Type())
+		}
+
+	case reflect.Array:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			err = fmt.Errorf("cannot encode type %q", v.Type())
+			break
+		}
+		if b.grow(v.Len()) {
+			data := b.data
+			for i := 0; i < v.Len(); i++ {
+				data = append(data, uint8(v.Index(i).Uint()))
+			}
+			b.setData(data)
 		}
 
 	case reflect.Struct:
 		fields := v.NumField()
 		for i := 0; i < fields; i++ {
+			if isSkipped(v.Type(), i) {
+				continue
+			}
+			if n := bitFields(v.Type(), i); n > 0 {
+				if err = b.marshalBits(v, i, n); err != nil {
+					break
+				}
+				i += n - 1
+				continue
+			}
+			if isOptional(v.Type(), i) {
+				b.PutOptionalBytes(v.Field(i).Bytes())
+				continue
+			}
 			if err = b.marshalType(v.Field(i)); err != nil {
 				break
 			}
@@ -132,6 +539,20 @@ func (b *Buffer) marshalType(v reflect.Value) (err error) {
 		b.PutUint16(uint16(v.Uint()))
 	case reflect.Uint8:
 		b.PutUint8(uint8(v.Uint()))
+	case reflect.Int64:
+		b.PutUint64(uint64(v.Int()))
+	case reflect.Int32:
+		b.PutUint32(uint32(v.Int()))
+	case reflect.Int16:
+		b.PutUint16(uint16(v.Int()))
+	case reflect.Int8:
+		b.PutUint8(uint8(v.Int()))
+	case reflect.Bool:
+		if v.Bool() {
+			b.PutUint8(1)
+		} else {
+			b.PutUint8(0)
+		}
 	}
 	return err
 }
@@ -155,6 +576,10 @@ func SizeOf(args ...interface{}) (n int) {
 }
 
 func sizeOfType(v reflect.Value) (n int) {
+	if v.Type() == durationType {
+		return 8
+	}
+
 	switch v.Kind() {
 	case reflect.Slice:
 		switch v.Type().Elem().Kind() {
@@ -167,21 +592,101 @@ func sizeOfType(v reflect.Value) (n int) {
 				n += sizeOfType(reflect.Indirect(v.Index(i)))
 			}
 		}
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			n += v.Len()
+		}
 	case reflect.Struct:
 		fields := v.NumField()
 		for i := 0; i < fields; i++ {
+			if isSkipped(v.Type(), i) {
+				continue
+			}
+			if bits := bitFields(v.Type(), i); bits > 0 {
+				n += (bits + 7) / 8
+				i += bits - 1
+				continue
+			}
+			if isOptional(v.Type(), i) {
+				n++
+				if !v.Field(i).IsNil() {
+					n += 4 + v.Field(i).Len()
+				}
+				continue
+			}
 			n += sizeOfType(v.Field(i))
 		}
 	case reflect.String:
 		n += 2 + len(v.String())
-	case reflect.Uint64:
+	case reflect.Uint64, reflect.Int64:
 		n += 8
-	case reflect.Uint32:
+	case reflect.Uint32, reflect.Int32:
 		n += 4
-	case reflect.Uint16:
+	case reflect.Uint16, reflect.Int16:
 		n += 2
-	case reflect.Uint8:
+	case reflect.Uint8, reflect.Int8, reflect.Bool:
+		n++
+	}
+	return n
+}
+
+// isSkipped reports whether field i of t is not encoded. Unexported
+// fields and fields tagged `wire:"-"` are skipped.
+func isSkipped(t reflect.Type, i int) bool {
+	f := t.Field(i)
+	return f.PkgPath != "" || f.Tag.Get("wire") == "-"
+}
+
+// isOptional reports whether field i of t is a []byte field tagged
+// `wire:"optional"`. Such fields are encoded with a leading presence byte
+// to distinguish nil from empty values.
+func isOptional(t reflect.Type, i int) bool {
+	f := t.Field(i)
+	return f.Tag.Get("wire") == "optional" &&
+		f.Type.Kind() == reflect.Slice &&
+		f.Type.Elem().Kind() == reflect.Uint8
+}
+
+// bitFields returns the number of consecutive fields of t, starting at
+// field i, that are tagged `wire:"bit"`. Such bool fields are packed into
+// shared bytes, least significant bit first. Skipped fields end a group.
+func bitFields(t reflect.Type, i int) (n int) {
+	for ; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("wire") != "bit" || isSkipped(t, i) {
+			break
+		}
 		n++
 	}
 	return n
 }
+
+func (b *Buffer) marshalBits(v reflect.Value, i, n int) error {
+	for j := 0; j < n; j += 8 {
+		var bits uint8
+		for k := 0; k < 8 && j+k < n; k++ {
+			f := v.Field(i + j + k)
+			if f.Kind() != reflect.Bool {
+				return fmt.Errorf("cannot encode type %q as bit", f.Type())
+			}
+			if f.Bool() {
+				bits |= 1 << uint(k)
+			}
+		}
+		b.PutUint8(bits)
+	}
+	return nil
+}
+
+func (b *Buffer) unmarshalBits(v reflect.Value, i, n int) error {
+	for j := 0; j < n; j += 8 {
+		bits := b.Uint8()
+		for k := 0; k < 8 && j+k < n; k++ {
+			f := v.Field(i + j + k)
+			if f.Kind() != reflect.Bool {
+				return fmt.Errorf("cannot decode type %q as bit", f.Type())
+			}
+			f.SetBool(bits&(1<<uint(k)) != 0)
+		}
+	}
+	return b.Err()
+}
@@ -1,8 +1,14 @@
 package wire
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"math"
+	"reflect"
+	"runtime"
 	"testing"
+	"time"
 )
 
 type testStruct struct {
@@ -54,3 +60,682 @@ func TestSizeOf(t *testing.T) {
 		}
 	}
 }
+
+func TestSkipType(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	for i, testcase := range []struct {
+		src interface{}
+	}{
+		{src: []testStruct{
+			testStruct{math.MaxUint64, math.MaxUint32, math.MaxUint16, math.MaxUint8, "hello world"},
+			testStruct{},
+		}},
+		{src: testStruct{math.MaxUint64, math.MaxUint32, math.MaxUint16, math.MaxUint8, "hello world"}},
+		{src: &testStruct{}},
+		{src: []string{"a", "b", "c", "d"}},
+		{src: []byte("hello world")},
+		{src: "hello world"},
+		{src: uint64(42)},
+		{src: uint32(42)},
+		{src: uint16(42)},
+		{src: uint8(42)},
+	} {
+		b.Reset()
+		if err := b.Marshal(testcase.src, uint32(0xcafe)); err != nil {
+			t.Fatalf("skip (%.4d): %v", i, err)
+		}
+
+		if err := b.SkipType(testcase.src); err != nil {
+			t.Errorf("skip (%.4d): %v", i, err)
+		}
+		if v := b.Uint32(); v != 0xcafe {
+			t.Errorf("skip (%.4d): expected trailing value %#x, got %#x", i, 0xcafe, v)
+		}
+	}
+
+	b = NewBuffer(PutString(nil, "hello world")[:5])
+	if err := b.SkipType(""); err != io.ErrUnexpectedEOF {
+		t.Errorf("skip: expected unexpected EOF error, got %v", err)
+	}
+
+	b = NewBuffer([]byte{0xff, 0xff, 0xff, 0xff, 1, 2})
+	if err := b.SkipType([]byte(nil)); err != io.ErrUnexpectedEOF {
+		t.Errorf("skip: expected unexpected EOF error for huge length, got %v", err)
+	}
+	b = NewBuffer([]byte{1, 2})
+	b.skip(-1)
+	if b.Err() != io.ErrUnexpectedEOF || b.Len() != 2 {
+		t.Errorf("skip: expected unexpected EOF error for negative length, got %v", b.Err())
+	}
+}
+
+func TestFieldError(t *testing.T) {
+	t.Parallel()
+
+	type entry struct {
+		Name string
+		Size uint32
+	}
+	type body struct {
+		Count   uint16
+		Entries []entry
+	}
+	type message struct {
+		Type uint8
+		Body body
+	}
+
+	src := message{Type: 1, Body: body{Count: 4, Entries: []entry{
+		{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4},
+	}}}
+	b := NewBuffer(nil)
+	if err := b.Marshal(src); err != nil {
+		t.Fatalf("field error: %v", err)
+	}
+	b.SetBuf(b.data[:b.Len()-6]) // truncate Entries[3].Name
+
+	var dst message
+	err := b.Unmarshal(&dst)
+	fe, ok := err.(*FieldError)
+	if !ok {
+		t.Fatalf("field error: expected *FieldError, got %T (%v)", err, err)
+	}
+	if want := "Body.Entries[3].Name"; fe.Path != want {
+		t.Errorf("field error: expected path %q, got %q", want, fe.Path)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("field error: expected unexpected EOF error, got %v", fe.Err)
+	}
+	if want := "wire: unexpected EOF decoding Body.Entries[3].Name"; err.Error() != want {
+		t.Errorf("field error: expected message %q, got %q", want, err)
+	}
+	if b.Err() != err {
+		t.Errorf("field error: expected buffer error %v, got %v", err, b.Err())
+	}
+
+	b = NewBuffer([]byte{1, 2})
+	b.Uint32()
+	if err := b.Unmarshal(&dst); err != io.ErrUnexpectedEOF {
+		t.Errorf("field error: expected unwrapped sticky error, got %v", err)
+	}
+}
+
+func TestUnmarshalSliceAppend(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	b.Marshal([]string{"c", "d"}, []string{})
+
+	dst := []string{"a", "b"}
+	var empty []string
+	if err := b.Unmarshal(&dst, &empty); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if want := []string{"a", "b", "c", "d"}; !reflect.DeepEqual(dst, want) {
+		t.Errorf("unmarshal: expected %q, got %q", want, dst)
+	}
+	if empty != nil {
+		t.Errorf("unmarshal: expected nil slice, got %#v", empty)
+	}
+}
+
+func TestUnmarshalSliceHugeCount(t *testing.T) {
+	// Not parallel: measures allocated bytes.
+	type page struct{ Data [4096]byte }
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	before := stats.TotalAlloc
+
+	var dst []page
+	err := NewBuffer([]byte{0xff, 0xff, 0x00}).Unmarshal(&dst)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unmarshal: expected unexpected EOF, got %v", err)
+	}
+	runtime.ReadMemStats(&stats)
+	if n := stats.TotalAlloc - before; n > 1<<20 {
+		t.Fatalf("unmarshal: allocated %d bytes for a 3 byte message", n)
+	}
+	if len(dst) != 0 {
+		t.Fatalf("unmarshal: expected no decoded elements, got %d", len(dst))
+	}
+
+	var names []string
+	if err := NewBuffer([]byte{0xff, 0xff, 0x00, 0x00}).Unmarshal(&names); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unmarshal: expected unexpected EOF, got %v", err)
+	}
+}
+
+func BenchmarkUnmarshalStructSlice(b *testing.B) {
+	src := make([]testStruct, 1000)
+	for i := range src {
+		src[i] = testStruct{math.MaxUint64, math.MaxUint32, math.MaxUint16, math.MaxUint8, "hello world"}
+	}
+	buf := NewBuffer(nil)
+	if err := buf.Marshal(src); err != nil {
+		b.Fatalf("marshal: %v", err)
+	}
+	data := buf.data
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var dst []testStruct
+		buf.SetBuf(data)
+		if err := buf.Unmarshal(&dst); err != nil {
+			b.Fatalf("unmarshal: %v", err)
+		}
+	}
+}
+
+func TestShortStructs(t *testing.T) {
+	t.Parallel()
+
+	type v1 struct {
+		Uint32 uint32
+		String string
+	}
+	type v2 struct {
+		Uint32 uint32
+		String string
+		Uint64 uint64
+		Names  []string
+	}
+
+	data := NewBuffer(nil)
+	data.Marshal(v1{42, "hello world"})
+
+	var dst v2
+	if err := NewBuffer(data.data).Unmarshal(&dst); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("short structs: expected unexpected EOF error, got %v", err)
+	}
+
+	dst = v2{}
+	b := NewBuffer(data.data, WithShortStructs())
+	if err := b.Unmarshal(&dst); err != nil {
+		t.Fatalf("short structs: %v", err)
+	}
+	if want := (v2{Uint32: 42, String: "hello world"}); !reflect.DeepEqual(dst, want) {
+		t.Fatalf("short structs: expected %+v, got %+v", want, dst)
+	}
+
+	b = NewBuffer(data.data[:5], WithShortStructs())
+	if err := b.Unmarshal(&dst); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("short structs: expected unexpected EOF error, got %v", err)
+	}
+
+	b = NewBuffer(nil, WithShortStructs())
+	if err := b.Unmarshal(&dst); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("short structs: expected unexpected EOF error for empty message, got %v", err)
+	}
+
+	type elem struct {
+		A, B uint8
+	}
+	type list struct {
+		N uint8
+		L []elem
+	}
+	data.Reset()
+	data.Marshal(list{N: 1, L: []elem{{1, 2}}})
+	data.data[1] = 3 // count 3, but only one element follows
+	var l list
+	b = NewBuffer(data.data, WithShortStructs())
+	if err := b.Unmarshal(&l); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("short structs: expected unexpected EOF error for truncated list, got %v (%+v)", err, l)
+	}
+}
+
+type testBits struct {
+	Uint8 uint8
+	A     bool `wire:"bit"`
+	B     bool `wire:"bit"`
+	C     bool `wire:"bit"`
+	D     bool `wire:"bit"`
+	E     bool `wire:"bit"`
+	F     bool `wire:"bit"`
+	G     bool `wire:"bit"`
+	H     bool `wire:"bit"`
+	I     bool `wire:"bit"`
+	Tag   uint16
+	J     bool `wire:"bit"`
+}
+
+func TestBitFields(t *testing.T) {
+	t.Parallel()
+
+	src := testBits{Uint8: 42, A: true, C: true, H: true, I: true, Tag: 7, J: true}
+	b := NewBuffer(nil)
+	if err := b.Marshal(src); err != nil {
+		t.Fatalf("bits: %v", err)
+	}
+	want := []byte{42, 0x85, 0x01, 7, 0, 0x01}
+	if !bytes.Equal(b.data, want) {
+		t.Fatalf("bits: expected encoding %v, got %v", want, b.data)
+	}
+	if size := SizeOf(src); size != len(want) {
+		t.Fatalf("bits: expected size %d, got %d", len(want), size)
+	}
+
+	var dst testBits
+	if err := b.Unmarshal(&dst); err != nil {
+		t.Fatalf("bits: %v", err)
+	}
+	if dst != src {
+		t.Fatalf("bits:\nwant %+v\ngot  %+v", src, dst)
+	}
+
+	b.Marshal(src)
+	if err := b.SkipType(src); err != nil || b.Len() != 0 {
+		t.Fatalf("bits: expected empty buffer after skip, got %d (%v)", b.Len(), err)
+	}
+
+	type invalid struct {
+		A bool   `wire:"bit"`
+		B uint16 `wire:"bit"`
+	}
+	if err := b.Marshal(invalid{}); err == nil {
+		t.Fatalf("bits: expected error for non-bool bit field")
+	}
+}
+
+func TestOptionalBytes(t *testing.T) {
+	t.Parallel()
+
+	type message struct {
+		Nil   []byte `wire:"optional"`
+		Empty []byte `wire:"optional"`
+		Data  []byte `wire:"optional"`
+		Plain []byte
+	}
+
+	src := message{Empty: []byte{}, Data: []byte("hello"), Plain: []byte{}}
+	b := NewBuffer(nil)
+	if err := b.Marshal(src); err != nil {
+		t.Fatalf("optional: %v", err)
+	}
+	if size := SizeOf(src); b.Len() != size || size != 1+5+10+4 {
+		t.Fatalf("optional: expected size %d, got %d", size, b.Len())
+	}
+
+	var dst message
+	if err := b.Unmarshal(&dst); err != nil {
+		t.Fatalf("optional: %v", err)
+	}
+	if dst.Nil != nil {
+		t.Errorf("optional: expected nil value, got %#v", dst.Nil)
+	}
+	if dst.Empty == nil || len(dst.Empty) != 0 {
+		t.Errorf("optional: expected empty value, got %#v", dst.Empty)
+	}
+	if string(dst.Data) != "hello" {
+		t.Errorf("optional: expected %q, got %q", "hello", dst.Data)
+	}
+	if dst.Plain != nil {
+		t.Errorf("optional: expected untagged empty value to decode as nil, got %#v", dst.Plain)
+	}
+
+	b.Marshal(src)
+	if err := b.SkipType(src); err != nil || b.Len() != 0 {
+		t.Fatalf("optional: expected empty buffer after skip, got %d (%v)", b.Len(), err)
+	}
+
+	b = NewBuffer([]byte{2})
+	b.OptionalBytes()
+	if b.Err() == nil {
+		t.Fatalf("optional: expected invalid presence byte error")
+	}
+}
+
+type signedStruct struct {
+	Int64 int64
+	Int32 int32
+	Int16 int16
+	Int8  int8
+	Bool  bool
+}
+
+func TestSignedAndBool(t *testing.T) {
+	t.Parallel()
+
+	for i, src := range []signedStruct{
+		{math.MinInt64, math.MinInt32, math.MinInt16, math.MinInt8, true},
+		{math.MaxInt64, math.MaxInt32, math.MaxInt16, math.MaxInt8, false},
+		{-1, -1, -1, -1, true},
+		{},
+	} {
+		b := NewBuffer(nil)
+		if err := b.Marshal(src); err != nil {
+			t.Fatalf("signed (%.4d): marshal failed: %v", i, err)
+		}
+		if size := SizeOf(src); b.Len() != size || size != 8+4+2+1+1 {
+			t.Fatalf("signed (%.4d): expected size %d, got %d", i, size, b.Len())
+		}
+
+		var dst signedStruct
+		if err := b.Unmarshal(&dst); err != nil {
+			t.Fatalf("signed (%.4d): unmarshal failed: %v", i, err)
+		}
+		if dst != src {
+			t.Fatalf("signed (%.4d): expected %+v, got %+v", i, src, dst)
+		}
+	}
+
+	b := NewBuffer([]byte{2})
+	var v bool
+	if err := b.Unmarshal(&v); err == nil {
+		t.Fatalf("signed: expected error decoding bool value 2")
+	}
+	if b.Err() == nil {
+		t.Fatalf("signed: expected sticky buffer error")
+	}
+}
+
+type qidStruct struct {
+	Type uint8
+	Qid  [13]byte
+	Name string
+}
+
+func TestByteArray(t *testing.T) {
+	t.Parallel()
+
+	src := qidStruct{Type: 1, Name: "hello"}
+	for i := range src.Qid {
+		src.Qid[i] = byte(i + 1)
+	}
+	b := NewBuffer(nil)
+	if err := b.Marshal(src); err != nil {
+		t.Fatalf("array: marshal failed: %v", err)
+	}
+	if size := SizeOf(src); b.Len() != size || size != 1+13+2+5 {
+		t.Fatalf("array: expected size %d, got %d", size, b.Len())
+	}
+	if want := []byte{1, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}; !bytes.HasPrefix(b.data, want) {
+		t.Fatalf("array: expected prefix %v, got %v", want, b.data)
+	}
+
+	var dst qidStruct
+	if err := b.Unmarshal(&dst); err != nil {
+		t.Fatalf("array: unmarshal failed: %v", err)
+	}
+	if dst != src {
+		t.Fatalf("array: expected %+v, got %+v", src, dst)
+	}
+
+	b = NewBuffer([]byte{1, 2, 3})
+	if err := b.Unmarshal(&dst); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("array: expected unexpected EOF, got %v", err)
+	}
+
+	var words [4]uint32
+	if err := NewBuffer(nil).Marshal(words); err == nil {
+		t.Fatalf("array: expected encode error for %T", words)
+	}
+	if err := NewBuffer(make([]byte, 16)).Unmarshal(&words); err == nil {
+		t.Fatalf("array: expected decode error for %T", words)
+	}
+}
+
+type skipStruct struct {
+	Uint32 uint32
+	Cached int `wire:"-"`
+	dirty  bool
+	Parent *string `wire:"-"`
+	String string
+}
+
+func TestSkipField(t *testing.T) {
+	t.Parallel()
+
+	parent := "parent"
+	src := skipStruct{Uint32: 42, Cached: 7, dirty: true, Parent: &parent, String: "hello"}
+	b := NewBuffer(nil)
+	if err := b.Marshal(src); err != nil {
+		t.Fatalf("skip: marshal failed: %v", err)
+	}
+	if size := SizeOf(src); b.Len() != size || size != 4+2+5 {
+		t.Fatalf("skip: expected size %d, got %d", size, b.Len())
+	}
+
+	var dst skipStruct
+	if err := b.Unmarshal(&dst); err != nil {
+		t.Fatalf("skip: unmarshal failed: %v", err)
+	}
+	if want := (skipStruct{Uint32: 42, String: "hello"}); dst != want {
+		t.Fatalf("skip: expected %+v, got %+v", want, dst)
+	}
+
+	type bits struct {
+		A bool `wire:"bit"`
+		b bool `wire:"bit"`
+		C bool `wire:"bit"`
+	}
+	bsrc := bits{A: true, b: true, C: true}
+	b.Reset()
+	if err := b.Marshal(bsrc); err != nil {
+		t.Fatalf("skip: marshal failed: %v", err)
+	}
+	if size := SizeOf(bsrc); b.Len() != size || size != 2 {
+		t.Fatalf("skip: expected size %d, got %d", size, b.Len())
+	}
+	var bdst bits
+	if err := b.Unmarshal(&bdst); err != nil {
+		t.Fatalf("skip: unmarshal failed: %v", err)
+	}
+	if want := (bits{A: true, C: true}); bdst != want {
+		t.Fatalf("skip: expected %+v, got %+v", want, bdst)
+	}
+}
+
+func TestDecodeHook(t *testing.T) {
+	t.Parallel()
+
+	var types []reflect.Type
+	hook := func(t reflect.Type, d time.Duration) {
+		types = append(types, t)
+	}
+
+	src := testStruct{1, 2, 3, 4, "hello world"}
+	data := NewBuffer(nil)
+	data.Marshal(src, "hello")
+	b := NewBuffer(data.data, WithDecodeHook(hook))
+
+	var (
+		dst testStruct
+		str string
+		u8  uint8
+	)
+	if err := b.Unmarshal(&dst, &str); err != nil {
+		t.Fatalf("hook: unmarshal failed: %v", err)
+	}
+	if err := b.Unmarshal(&u8); err == nil {
+		t.Fatalf("hook: expected decode error")
+	}
+	want := []reflect.Type{reflect.TypeOf(dst), reflect.TypeOf(str)}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("hook: expected types %v, got %v", want, types)
+	}
+}
+
+type timeoutStruct struct {
+	Timeout  time.Duration
+	Interval time.Duration
+	Name     string
+}
+
+func TestDuration(t *testing.T) {
+	t.Parallel()
+
+	src := timeoutStruct{-time.Second, math.MaxInt64, "hello"}
+	b := NewBuffer(nil)
+	if err := b.Marshal(src); err != nil {
+		t.Fatalf("duration: marshal failed: %v", err)
+	}
+	if size := SizeOf(src); b.Len() != size || size != 8+8+2+5 {
+		t.Fatalf("duration: expected size %d, got %d", size, b.Len())
+	}
+	if v, _ := ConsumeUint64(b.data); int64(v) != -int64(time.Second) {
+		t.Fatalf("duration: expected nanoseconds, got %d", v)
+	}
+
+	var dst timeoutStruct
+	if err := b.Unmarshal(&dst); err != nil {
+		t.Fatalf("duration: unmarshal failed: %v", err)
+	}
+	if dst != src {
+		t.Fatalf("duration: expected %+v, got %+v", src, dst)
+	}
+}
+
+func TestUnsupportedSlice(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	for i, src := range []interface{}{
+		[]interface{}{uint8(1)},
+		[]map[string]string{},
+		[]chan int{},
+		[][]string{},
+		[]*testStruct{{}},
+	} {
+		b.Reset()
+		if err := b.Marshal(src); err == nil {
+			t.Errorf("unsupported (%.4d): expected encode error for %T", i, src)
+		}
+		if b.Len() != 0 {
+			t.Errorf("unsupported (%.4d): expected empty buffer, got %d", i, b.Len())
+		}
+
+		b = NewBuffer(PutUint16(nil, 0))
+		if err := b.Unmarshal(allocType(t, src)); err == nil {
+			t.Errorf("unsupported (%.4d): expected decode error for %T", i, src)
+		}
+	}
+}
+
+func TestUnmarshalArgs(t *testing.T) {
+	t.Parallel()
+
+	var v uint32
+	for i, testcase := range []struct {
+		arg  interface{}
+		want string
+	}{
+		{v, `cannot decode into non-pointer type "uint32", pass &v instead of v`},
+		{(*uint32)(nil), `cannot decode <nil> pointer "*uint32"`},
+		{nil, `cannot decode <nil> value`},
+	} {
+		b := NewBuffer(PutUint32(nil, 42))
+		err := b.Unmarshal(testcase.arg)
+		if err == nil || err.Error() != testcase.want {
+			t.Errorf("unmarshal (%.4d): expected error %q, got %v", i, testcase.want, err)
+		}
+	}
+}
+
+func TestDecodeFixedSlice(t *testing.T) {
+	t.Parallel()
+
+	type record struct {
+		ID    uint32
+		Size  uint64
+		Flags uint8
+	}
+
+	src := []record{{1, 100, 0x1}, {2, 200, 0x2}, {3, 300, 0x3}}
+	b := NewBuffer(nil)
+	for _, r := range src {
+		b.Marshal(r)
+	}
+
+	dst := make([]record, 4)
+	if err := b.DecodeFixedSlice(dst, len(src)); err != nil {
+		t.Fatalf("fixed slice: %v", err)
+	}
+	if !reflect.DeepEqual(dst[:3], src) || dst[3] != (record{}) {
+		t.Fatalf("fixed slice:\nwant %+v\ngot  %+v", src, dst)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("fixed slice: expected empty buffer, got %d", b.Len())
+	}
+
+	for i, testcase := range []struct {
+		dst   interface{}
+		count int
+	}{
+		{make([]record, 1), 2},
+		{make([]testStruct, 1), 1},
+		{record{}, 1},
+	} {
+		if err := NewBuffer(make([]byte, 64)).DecodeFixedSlice(testcase.dst, testcase.count); err == nil {
+			t.Errorf("fixed slice (%.4d): expected error for %T", i, testcase.dst)
+		}
+	}
+
+	b = NewBuffer(make([]byte, 12))
+	if err := b.DecodeFixedSlice(&dst, 1); err != io.ErrUnexpectedEOF {
+		t.Errorf("fixed slice: expected unexpected EOF error, got %v", err)
+	}
+
+	flags := make([]bool, 3)
+	b = NewBuffer([]byte{1, 7, 0, 0xff})
+	err := b.DecodeFixedSlice(flags, 3)
+	if err == nil || b.Err() != err {
+		t.Fatalf("fixed slice: expected sticky bool error, got %v (buffer %v)", err, b.Err())
+	}
+	b.Uint8()
+	if b.Err() != err {
+		t.Errorf("fixed slice: expected later reads to fail, got %v", b.Err())
+	}
+}
+
+func TestRangeStructs(t *testing.T) {
+	t.Parallel()
+
+	src := []testStruct{
+		testStruct{1, 2, 3, 4, "a"},
+		testStruct{5, 6, 7, 8, "b"},
+		testStruct{9, 10, 11, 12, "c"},
+	}
+	b := NewBuffer(nil)
+	b.Marshal(src, uint8(42))
+
+	var got []testStruct
+	err := b.RangeStructs(testStruct{}, func(elem *Buffer) error {
+		if len(got) == 1 {
+			got = append(got, testStruct{Uint64: elem.Uint64()}) // partial decode
+			return nil
+		}
+		var v testStruct
+		if err := elem.Unmarshal(&v); err != nil {
+			return err
+		}
+		if elem.Len() != 0 {
+			t.Errorf("range: expected element to be fully consumed, got %d", elem.Len())
+		}
+		got = append(got, v)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("range: %v", err)
+	}
+	want := []testStruct{src[0], testStruct{Uint64: 5}, src[2]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("range:\nwant %+v\ngot  %+v", want, got)
+	}
+	if v := b.Uint8(); v != 42 {
+		t.Fatalf("range: expected trailing value 42, got %d", v)
+	}
+
+	b.Reset()
+	b.Marshal(src)
+	b.SetBuf(b.data[:b.Len()-1])
+	calls := 0
+	err = b.RangeStructs(&testStruct{}, func(*Buffer) error { calls++; return nil })
+	if !errors.Is(err, io.ErrUnexpectedEOF) || calls != 2 {
+		t.Fatalf("range: expected unexpected EOF error after 2 calls, got %v after %d", err, calls)
+	}
+}
@@ -0,0 +1,82 @@
+package wire
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// AssertRoundTrip marshals v, unmarshals the result into a newly
+// allocated value of the same type and reports a test failure if the
+// decoded value differs from v, if the encoded size differs from
+// SizeOf(v) or if any bytes are left over.
+func AssertRoundTrip(t testing.TB, v interface{}) {
+	t.Helper()
+
+	b := NewBuffer(nil)
+	if err := b.Marshal(v); err != nil {
+		t.Fatalf("wire: marshal %T: %v", v, err)
+	}
+	if size := SizeOf(v); b.Len() != size {
+		t.Errorf("wire: expected marshaled size %d of %T, got %d", size, v, b.Len())
+	}
+	assertDecode(t, v, b)
+}
+
+// TestVector is a Go value together with its expected wire-format
+// encoding, for example taken from a packet capture.
+type TestVector struct {
+	Name  string
+	Value interface{}
+	Data  []byte
+}
+
+// RunVectors runs a subtest for each test vector which checks that the
+// value marshals to exactly the expected bytes and that the expected
+// bytes unmarshal to the value without any bytes left over.
+func RunVectors(t *testing.T, vectors []TestVector) {
+	t.Helper()
+
+	for _, v := range vectors {
+		v := v
+		t.Run(v.Name, func(t *testing.T) {
+			b := NewBuffer(nil)
+			if err := b.Marshal(v.Value); err != nil {
+				t.Fatalf("wire: marshal %T: %v", v.Value, err)
+			}
+			if !bytes.Equal(b.data, v.Data) {
+				t.Errorf("wire: marshal %T:\nwant % x\ngot  % x", v.Value, v.Data, b.data)
+			}
+
+			b.SetBuf(append([]byte(nil), v.Data...))
+			assertDecode(t, v.Value, b)
+		})
+	}
+}
+
+// assertDecode unmarshals b into a newly allocated value of the same
+// type as v and reports a test failure if it differs from v or if any
+// bytes are left over.
+func assertDecode(t testing.TB, v interface{}, b *Buffer) {
+	t.Helper()
+
+	typ := reflect.TypeOf(v)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	dst := reflect.New(typ)
+	if err := b.Unmarshal(dst.Interface()); err != nil {
+		t.Fatalf("wire: unmarshal %T: %v", v, err)
+	}
+	if b.Len() != 0 {
+		t.Errorf("wire: %d bytes left over after unmarshaling %T", b.Len(), v)
+	}
+
+	got := dst.Interface()
+	if reflect.TypeOf(v).Kind() != reflect.Ptr {
+		got = dst.Elem().Interface()
+	}
+	if !reflect.DeepEqual(v, got) {
+		t.Errorf("wire: round trip of %T:\nwant %#v\ngot  %#v", v, v, got)
+	}
+}
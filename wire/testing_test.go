@@ -0,0 +1,43 @@
+package wire
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAssertRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	AssertRoundTrip(t, testStruct{math.MaxUint64, math.MaxUint32, math.MaxUint16, math.MaxUint8, "hello world"})
+	AssertRoundTrip(t, &testStruct{1, 2, 3, 4, "hello world"})
+	AssertRoundTrip(t, []string{"a", "b", "c"})
+	AssertRoundTrip(t, []byte("hello world"))
+	AssertRoundTrip(t, uint32(42))
+}
+
+func TestRunVectors(t *testing.T) {
+	t.Parallel()
+
+	type tversion struct {
+		Header  Header
+		Msize   uint32
+		Version string
+	}
+
+	RunVectors(t, []TestVector{
+		{
+			Name:  "Tversion",
+			Value: tversion{Header{100, 0xffff}, 8192, "9P2000"},
+			Data: []byte{
+				0x64, 0xff, 0xff, // type, tag
+				0x00, 0x20, 0x00, 0x00, // msize
+				0x06, 0x00, '9', 'P', '2', '0', '0', '0', // version
+			},
+		},
+		{
+			Name:  "Twalk names",
+			Value: []string{"usr", "bin"},
+			Data:  []byte{0x02, 0x00, 0x03, 0x00, 'u', 's', 'r', 0x03, 0x00, 'b', 'i', 'n'},
+		},
+	})
+}
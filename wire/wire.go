@@ -7,8 +7,15 @@
 package wire
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"math"
+	"math/bits"
+	"reflect"
+	"time"
 )
 
 // ParseError converts an error code into an error value. This returns nil if n
@@ -48,6 +55,16 @@ func ConsumeBytes(b []byte, target []byte) ([]byte, int) {
 	return target, 4 + n
 }
 
+// ConsumeRaw parses the next n bytes of b as a raw value without a length
+// prefix, reporting its length. The returned slice aliases b. This returns
+// a negative length upon an error.
+func ConsumeRaw(b []byte, n int) ([]byte, int) {
+	if n < 0 || n > len(b) {
+		return nil, errUnexpectedEOF
+	}
+	return b[:n:n], n
+}
+
 // ConsumeString parses b as a length-prefixed string value, reporting its
 // length. This returns a negative length upon an error.
 func ConsumeString(b []byte) (string, int) {
@@ -151,13 +168,69 @@ func PutUint8(b []byte, v uint8) []byte {
 	return append(b, v)
 }
 
+// Option configures a Buffer.
 type Option func(*Buffer)
 
+// WithMaxBufSize limits the size of the buffer to n bytes. Writes that
+// would grow the buffer past n set the buffer error instead. A value of
+// n <= 0 means no limit.
+func WithMaxBufSize(n int) Option {
+	return func(b *Buffer) { b.maxSize = n }
+}
+
+// WithShortStructs makes Unmarshal accept messages that end before all
+// fields of a struct are decoded. Once the buffer is exhausted at a field
+// boundary after the first field, the remaining fields are left unchanged.
+// This allows decoding messages written by peers using an older, shorter
+// struct definition. Only the trailing fields of the values passed to
+// Unmarshal may be missing; nested structs and list elements must be
+// complete.
+func WithShortStructs() Option {
+	return func(b *Buffer) { b.shortStructs = true }
+}
+
+// WithMaxStringLen limits the length of strings decoded from the buffer
+// to n bytes. Longer strings set the buffer error to ErrValueTooLarge
+// before any memory is allocated. A value of n <= 0 means no limit.
+func WithMaxStringLen(n int) Option {
+	return func(b *Buffer) { b.maxStringLen = n }
+}
+
+// WithMaxBytesLen limits the length of byte slices decoded from the
+// buffer to n bytes. Longer values set the buffer error to
+// ErrValueTooLarge before any memory is allocated. A value of n <= 0
+// means no limit.
+func WithMaxBytesLen(n int) Option {
+	return func(b *Buffer) { b.maxBytesLen = n }
+}
+
+// WithDecodeHook sets a function that is called after each value is
+// successfully decoded by Unmarshal, with the type of the value and the
+// time it took to decode it. It can be used to collect per-message-type
+// latency metrics.
+func WithDecodeHook(fn func(t reflect.Type, d time.Duration)) Option {
+	return func(b *Buffer) { b.decodeHook = fn }
+}
+
+// ErrValueTooLarge is returned when a decoded string or bytes value is
+// longer than the configured limit.
+var ErrValueTooLarge = errors.New("value length limit exceeded")
+
+// ErrBufferFull is returned when a write would grow a Buffer past its
+// maximum size.
+var ErrBufferFull = errors.New("buffer size limit exceeded")
+
 // Buffer is a buffer for encoding and decoding the wire format. It may be
 // eused between invocations to reduce memory usage.
 type Buffer struct {
-	data []byte
-	err  error
+	data         []byte
+	err          error
+	maxSize      int
+	shortStructs bool
+	maxStringLen int
+	maxBytesLen  int
+	peak         int
+	decodeHook   func(reflect.Type, time.Duration)
 }
 
 // NewBuffer allocates a new Buffer initialized with data, where the contents
@@ -182,7 +255,23 @@ func (b *Buffer) Reset() {
 
 // SetBuf sets data as the internal buffer, where the contents of data are
 // considered the unread portion of b.
-func (b *Buffer) SetBuf(data []byte) { b.data = data }
+func (b *Buffer) SetBuf(data []byte) { b.setData(data) }
+
+// setData sets data as the internal buffer and records its capacity.
+func (b *Buffer) setData(data []byte) {
+	if cap(data) > b.peak {
+		b.peak = cap(data)
+	}
+	b.data = data
+}
+
+// PeakCap returns the largest capacity the internal buffer of b reached
+// since b was created or ResetStats was called. It is not affected by
+// Reset.
+func (b *Buffer) PeakCap() int { return b.peak }
+
+// ResetStats resets the peak capacity of b to the current capacity.
+func (b *Buffer) ResetStats() { b.peak = cap(b.data) }
 
 func (b *Buffer) setErr(err error) {
 	if b.err == nil && err != nil {
@@ -196,47 +285,131 @@ func (b *Buffer) Err() error { return b.err }
 // Len returns the number of bytes of the unread portion of b.
 func (b *Buffer) Len() int { return len(b.data) }
 
+// grow reports whether n more bytes fit into b. Otherwise it sets the
+// buffer error.
+func (b *Buffer) grow(n int) bool {
+	if b.maxSize > 0 && n > b.maxSize-len(b.data) {
+		b.setErr(ErrBufferFull)
+		return false
+	}
+	return true
+}
+
 // PutBytes appends v to b as a length-prefixed bytes value.
-func (b *Buffer) PutBytes(v []byte) { b.data = PutBytes(b.data, v) }
+func (b *Buffer) PutBytes(v []byte) {
+	if b.grow(4 + len(v)) {
+		b.setData(PutBytes(b.data, v))
+	}
+}
 
 // PutString appends v to b as a length-prefixed string value.
-func (b *Buffer) PutString(v string) { b.data = PutString(b.data, v) }
+func (b *Buffer) PutString(v string) {
+	if b.grow(2 + len(v)) {
+		b.setData(PutString(b.data, v))
+	}
+}
 
 // PutUint64 appends v to b as a little-endian uint64.
-func (b *Buffer) PutUint64(v uint64) { b.data = PutUint64(b.data, v) }
+func (b *Buffer) PutUint64(v uint64) {
+	if b.grow(8) {
+		b.setData(PutUint64(b.data, v))
+	}
+}
 
 // PutUint32 appends v to b as a little-endian uint32.
-func (b *Buffer) PutUint32(v uint32) { b.data = PutUint32(b.data, v) }
+func (b *Buffer) PutUint32(v uint32) {
+	if b.grow(4) {
+		b.setData(PutUint32(b.data, v))
+	}
+}
 
 // PutUint16 appends v to b as a little-endian uint16.
-func (b *Buffer) PutUint16(v uint16) { b.data = PutUint16(b.data, v) }
+func (b *Buffer) PutUint16(v uint16) {
+	if b.grow(2) {
+		b.setData(PutUint16(b.data, v))
+	}
+}
 
 // PutUint8 appends v to b as a little-endian uint8.
-func (b *Buffer) PutUint8(v uint8) { b.data = PutUint8(b.data, v) }
+func (b *Buffer) PutUint8(v uint8) {
+	if b.grow(1) {
+		b.setData(PutUint8(b.data, v))
+	}
+}
 
 // Bytes decodes a 32-bit count-delimited bytes value from b.
 func (b *Buffer) Bytes() []byte {
 	if b.Err() != nil {
 		return nil
 	}
+	if m, n := ConsumeUint32(b.data); n > 0 && b.maxBytesLen > 0 && int64(m) > int64(b.maxBytesLen) {
+		b.setErr(ErrValueTooLarge)
+		return nil
+	}
 
 	v, n := ConsumeBytes(b.data, nil)
 	if n < 0 {
 		b.setErr(ParseError(n))
+		return v
 	}
 	b.data = b.data[n:]
 	return v
 }
 
+// SubMessage decodes a 32-bit count-delimited value from b, as written by
+// PutBytes, and returns a Buffer whose unread portion is exactly that
+// value. The returned Buffer shares its data with b and inherits the
+// options of b. If the value cannot be decoded, the returned Buffer
+// reports the error of b.
+func (b *Buffer) SubMessage() *Buffer {
+	sub := *b
+	sub.data, sub.err = nil, b.Err()
+	if b.Err() != nil {
+		return &sub
+	}
+
+	m, n := ConsumeUint32(b.data)
+	if n < 0 || m > uint32(len(b.data[n:])) {
+		b.setErr(io.ErrUnexpectedEOF)
+		sub.err = b.Err()
+		return &sub
+	}
+	sub.data = b.data[n:][:m:m]
+	sub.peak = int(m)
+	b.data = b.data[n+int(m):]
+	return &sub
+}
+
+// Raw decodes the next n bytes from b as a raw value without a length
+// prefix. The returned slice is a copy.
+func (b *Buffer) Raw(n int) []byte {
+	if b.Err() != nil {
+		return nil
+	}
+
+	v, n := ConsumeRaw(b.data, n)
+	if n < 0 {
+		b.setErr(ParseError(n))
+		return nil
+	}
+	b.data = b.data[n:]
+	return append([]byte(nil), v...)
+}
+
 // String decodes a 16-bit count-delimited string value from b.
 func (b *Buffer) String() string {
 	if b.Err() != nil {
 		return ""
 	}
+	if m, n := ConsumeUint16(b.data); n > 0 && b.maxStringLen > 0 && int(m) > b.maxStringLen {
+		b.setErr(ErrValueTooLarge)
+		return ""
+	}
 
 	v, n := ConsumeString(b.data)
 	if n < 0 {
 		b.setErr(ParseError(n))
+		return v
 	}
 	b.data = b.data[n:]
 	return v
@@ -251,6 +424,7 @@ func (b *Buffer) Uint64() uint64 {
 	v, n := ConsumeUint64(b.data)
 	if n < 0 {
 		b.setErr(ParseError(n))
+		return v
 	}
 	b.data = b.data[n:]
 	return v
@@ -265,6 +439,7 @@ func (b *Buffer) Uint32() uint32 {
 	v, n := ConsumeUint32(b.data)
 	if n < 0 {
 		b.setErr(ParseError(n))
+		return v
 	}
 	b.data = b.data[n:]
 	return v
@@ -279,6 +454,7 @@ func (b *Buffer) Uint16() uint16 {
 	v, n := ConsumeUint16(b.data)
 	if n < 0 {
 		b.setErr(ParseError(n))
+		return v
 	}
 	b.data = b.data[n:]
 	return v
@@ -293,28 +469,349 @@ func (b *Buffer) Uint8() uint8 {
 	v, n := ConsumeUint8(b.data)
 	if n < 0 {
 		b.setErr(ParseError(n))
+		return v
 	}
 	b.data = b.data[n:]
 	return v
 }
 
+// Errors wrapped by ExpectUint32 and ExpectUint8.
+var (
+	ErrMagicMismatch   = errors.New("wire: magic mismatch")
+	ErrVersionMismatch = errors.New("wire: version mismatch")
+)
+
+// ExpectUint32 decodes a little-endian uint32 magic number from b and
+// sets the buffer error, wrapping ErrMagicMismatch, if it is not equal
+// to want.
+func (b *Buffer) ExpectUint32(want uint32) error {
+	v := b.Uint32()
+	if b.Err() == nil && v != want {
+		b.setErr(fmt.Errorf("%w: got %#x want %#x", ErrMagicMismatch, v, want))
+	}
+	return b.Err()
+}
+
+// ExpectUint8 decodes a uint8 version number from b and sets the buffer
+// error, wrapping ErrVersionMismatch, if it is not equal to want.
+func (b *Buffer) ExpectUint8(want uint8) error {
+	v := b.Uint8()
+	if b.Err() == nil && v != want {
+		b.setErr(fmt.Errorf("%w: got %#x want %#x", ErrVersionMismatch, v, want))
+	}
+	return b.Err()
+}
+
+// skip advances b past the next n bytes. A negative n, as produced by
+// converting a large 32-bit length to int on 32-bit platforms, is
+// treated as a short read.
+func (b *Buffer) skip(n int) {
+	if b.Err() != nil {
+		return
+	}
+	if n < 0 || n > len(b.data) {
+		b.setErr(io.ErrUnexpectedEOF)
+		return
+	}
+	b.data = b.data[n:]
+}
+
+// PutOptionalBytes appends v to b as a presence byte followed by a
+// length-prefixed bytes value if v is not nil. Unlike PutBytes, it
+// preserves the distinction between nil and empty values.
+func (b *Buffer) PutOptionalBytes(v []byte) {
+	if v == nil {
+		b.PutUint8(0)
+		return
+	}
+	b.PutUint8(1)
+	b.PutBytes(v)
+}
+
+// OptionalBytes decodes a value encoded by PutOptionalBytes from b. It
+// returns nil for an absent value and a non-nil slice otherwise.
+func (b *Buffer) OptionalBytes() []byte {
+	switch b.Uint8() {
+	case 0:
+		return nil
+	case 1:
+		if v := b.Bytes(); v != nil {
+			return v
+		}
+		if b.Err() != nil {
+			return nil
+		}
+		return []byte{}
+	}
+	b.setErr(errors.New("invalid presence byte"))
+	return nil
+}
+
+// PutOptionalStrings appends v to b as a presence byte followed by a
+// 16-bit count-delimited list of string values if v is not nil. It
+// distinguishes an absent list from an empty one.
+func (b *Buffer) PutOptionalStrings(v *[]string) {
+	if v == nil {
+		b.PutUint8(0)
+		return
+	}
+	b.PutUint8(1)
+	b.PutNames(*v)
+}
+
+// OptionalStrings decodes a value encoded by PutOptionalStrings from b.
+// It returns nil for an absent list and a pointer to a non-nil slice
+// otherwise.
+func (b *Buffer) OptionalStrings() *[]string {
+	switch b.Uint8() {
+	case 0:
+		return nil
+	case 1:
+		v := b.Names()
+		if b.Err() != nil {
+			return nil
+		}
+		return &v
+	}
+	b.setErr(errors.New("invalid presence byte"))
+	return nil
+}
+
+// PutOptional appends an optional field to b, consisting of id, a 32-bit
+// length and the value encoded by fn. A list of optional fields must be
+// preceded by its 16-bit count, written by PutUint16.
+func (b *Buffer) PutOptional(id uint16, fn func(*Buffer)) {
+	b.PutUint16(id)
+	b.PutUint32(0) // length, patched below
+	if b.Err() != nil {
+		return
+	}
+
+	off := len(b.data)
+	fn(b)
+	if b.Err() != nil {
+		return
+	}
+	PutUint32(b.data[:off-4], uint32(len(b.data)-off))
+}
+
+// RangeOptional decodes a 16-bit count-delimited list of optional fields
+// written by PutOptional and calls fn for each field with its id and a
+// Buffer scoped to its value. Values fn does not decode are skipped. If
+// fn returns an error, RangeOptional stops and returns it.
+func (b *Buffer) RangeOptional(fn func(id uint16, sub *Buffer) error) error {
+	n := int(b.Uint16())
+	for i := 0; i < n && b.Err() == nil; i++ {
+		id := b.Uint16()
+		sub := b.SubMessage()
+		if b.Err() != nil {
+			break
+		}
+		if err := fn(id, sub); err != nil {
+			return err
+		}
+	}
+	return b.Err()
+}
+
+// StartVarSection reserves space for the length prefix of a section whose
+// length is not known in advance and returns a mark to be passed to
+// EndVarSection once the section is written. The mark is an offset into
+// the unread portion of b, so b must not be read from until the section
+// is ended.
+func (b *Buffer) StartVarSection() int {
+	mark := len(b.data)
+	if b.grow(binary.MaxVarintLen32) {
+		b.setData(append(b.data, make([]byte, binary.MaxVarintLen32)...))
+	}
+	return mark
+}
+
+// EndVarSection writes the length of the section started at mark as an
+// unsigned varint and moves the section to directly follow it.
+func (b *Buffer) EndVarSection(mark int) {
+	if b.Err() != nil {
+		return
+	}
+	start := mark + binary.MaxVarintLen32
+	if mark < 0 || start > len(b.data) || !isZero(b.data[mark:start]) {
+		b.setErr(errors.New("invalid section mark"))
+		return
+	}
+	size := len(b.data) - start
+	if uint64(size) > math.MaxUint32 {
+		b.setErr(errors.New("section too large"))
+		return
+	}
+
+	n := binary.PutUvarint(b.data[mark:], uint64(size))
+	copy(b.data[mark+n:], b.data[start:])
+	b.data = b.data[:mark+n+size]
+}
+
+func isZero(p []byte) bool {
+	for _, c := range p {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// VarSection decodes a section written by StartVarSection and
+// EndVarSection from b and returns a Buffer whose unread portion is
+// exactly the section. The returned Buffer shares its data with b.
+func (b *Buffer) VarSection() *Buffer {
+	sub := *b
+	sub.data, sub.err = nil, b.Err()
+	if b.Err() != nil {
+		return &sub
+	}
+
+	m, n := binary.Uvarint(b.data)
+	if n <= 0 || m > uint64(len(b.data[n:])) {
+		b.setErr(io.ErrUnexpectedEOF)
+		sub.err = b.Err()
+		return &sub
+	}
+	sub.data = b.data[n:][:m:m]
+	sub.peak = int(m)
+	b.data = b.data[n+int(m):]
+	return &sub
+}
+
+// Header is the type and tag header shared by all 9P2000 messages. The
+// leading size field is not part of Header.
+type Header struct {
+	Type uint8
+	Tag  uint16
+}
+
+// PutHeader appends h to b.
+func (b *Buffer) PutHeader(h Header) {
+	b.PutUint8(h.Type)
+	b.PutUint16(h.Tag)
+}
+
+// Header decodes a message type and tag from b.
+func (b *Buffer) Header() (Header, error) {
+	h := Header{Type: b.Uint8(), Tag: b.Uint16()}
+	if err := b.Err(); err != nil {
+		return Header{}, err
+	}
+	return h, nil
+}
+
+// PutNames appends v to b as a 16-bit count followed by that many
+// length-prefixed string values, as used by 9P2000 Twalk wnames.
+func (b *Buffer) PutNames(v []string) {
+	if len(v) > math.MaxUint16 {
+		b.setErr(errors.New("too many names"))
+		return
+	}
+	b.PutUint16(uint16(len(v)))
+	for _, name := range v {
+		b.PutString(name)
+	}
+}
+
+// Names decodes a 16-bit count-delimited list of string values from b.
+func (b *Buffer) Names() []string {
+	n := int(b.Uint16())
+	if b.Err() != nil {
+		return nil
+	}
+	if n*2 > len(b.data) { // each name needs at least its 2-byte size
+		b.setErr(io.ErrUnexpectedEOF)
+		return nil
+	}
+
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		name := b.String()
+		if b.Err() != nil {
+			return nil
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// PutBitset64 appends the set of values in v to b as a little-endian
+// uint64 bitmask. Values must be in the range [0, 63].
+func (b *Buffer) PutBitset64(v []uint8) {
+	var mask uint64
+	for _, bit := range v {
+		if bit >= 64 {
+			b.setErr(fmt.Errorf("bitset value %d out of range", bit))
+			return
+		}
+		mask |= 1 << bit
+	}
+	b.PutUint64(mask)
+}
+
+// Bitset64 decodes a 64-bit bitmask from b and returns the set values
+// in ascending order.
+func (b *Buffer) Bitset64() []uint8 {
+	mask := b.Uint64()
+	if b.Err() != nil {
+		return nil
+	}
+
+	set := make([]uint8, 0, bits.OnesCount64(mask))
+	for mask != 0 {
+		bit := bits.TrailingZeros64(mask)
+		set = append(set, uint8(bit))
+		mask &^= 1 << uint(bit)
+	}
+	return set
+}
+
+// Hash64 returns the 64-bit FNV-1a hash of the unread portion of b without
+// consuming it. The hash depends only on the encoded bytes and is stable
+// across processes.
+func (b *Buffer) Hash64() uint64 {
+	h := fnv.New64a()
+	h.Write(b.data)
+	return h.Sum64()
+}
+
+// HashOf returns the 64-bit FNV-1a hash of the wire-format encoding of
+// args.
+func HashOf(args ...interface{}) (uint64, error) {
+	b := NewBuffer(make([]byte, 0, SizeOf(args...)))
+	if err := b.Marshal(args...); err != nil {
+		return 0, err
+	}
+	return b.Hash64(), nil
+}
+
 // WriteString appends the contents of s to b, growing the buffer as needed. The
-// return value n is the length of p; err is always nil.
+// return value n is the length of p; err is ErrBufferFull if s does not fit
+// into b, otherwise nil.
 func (b *Buffer) WriteString(s string) (int, error) {
 	if len(s) == 0 {
 		return 0, nil
 	}
-	b.data = append(b.data, s...)
+	if !b.grow(len(s)) {
+		return 0, ErrBufferFull
+	}
+	b.setData(append(b.data, s...))
 	return len(s), nil
 }
 
 // Write appends the contents of p to b, growing the buffer as needed. The
-// return value n is the length of p; err is always nil.
+// return value n is the length of p; err is ErrBufferFull if p does not fit
+// into b, otherwise nil.
 func (b *Buffer) Write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
-	b.data = append(b.data, p...)
+	if !b.grow(len(p)) {
+		return 0, ErrBufferFull
+	}
+	b.setData(append(b.data, p...))
 	return len(p), nil
 }
 
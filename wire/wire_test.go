@@ -2,6 +2,8 @@ package wire
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"io"
 	"math"
 	"reflect"
@@ -85,6 +87,31 @@ func TestMarshalUnmarshal(t *testing.T) {
 	}
 }
 
+func TestShortRead(t *testing.T) {
+	t.Parallel()
+
+	for i, testcase := range []struct {
+		read func(*Buffer)
+		data []byte
+	}{
+		{func(b *Buffer) { b.Bytes() }, append(PutUint32(nil, 5), "abc"...)},
+		{func(b *Buffer) { _ = b.String() }, append(PutUint16(nil, 5), "abc"...)},
+		{func(b *Buffer) { b.Uint64() }, make([]byte, 7)},
+		{func(b *Buffer) { b.Uint32() }, make([]byte, 3)},
+		{func(b *Buffer) { b.Uint16() }, make([]byte, 1)},
+		{func(b *Buffer) { b.Uint8() }, []byte{}},
+	} {
+		b := NewBuffer(testcase.data)
+		testcase.read(b)
+		if b.Err() != io.ErrUnexpectedEOF {
+			t.Errorf("short read (%.4d): expected unexpected EOF error, got %v", i, b.Err())
+		}
+		if b.Len() != len(testcase.data) {
+			t.Errorf("short read (%.4d): expected %d unread bytes, got %d", i, len(testcase.data), b.Len())
+		}
+	}
+}
+
 func TestParseError(t *testing.T) {
 	t.Parallel()
 
@@ -98,6 +125,9 @@ func TestParseError(t *testing.T) {
 	_, n := ConsumeBytes(nil, nil)
 	check(t, "ConsumeBytes", n, errUnexpectedEOF)
 
+	_, n = ConsumeRaw([]byte("abc"), 4)
+	check(t, "ConsumeRaw", n, errUnexpectedEOF)
+
 	_, n = ConsumeString(nil)
 	check(t, "ConsumeString", n, errUnexpectedEOF)
 
@@ -212,3 +242,472 @@ func TestCopy(t *testing.T) {
 		t.Fatalf("copy: expected content %q, got %q", str, buf.String())
 	}
 }
+
+func TestNames(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	for i, names := range [][]string{
+		{"usr", "local", "bin"},
+		{"", "a", ""},
+		{},
+	} {
+		b.Reset()
+		b.PutNames(names)
+		if b.Len() != SizeOf(names) {
+			t.Errorf("names (%.4d): expected size %d, got %d", i, SizeOf(names), b.Len())
+		}
+
+		got := b.Names()
+		if err := b.Err(); err != nil {
+			t.Fatalf("names (%.4d): %v", i, err)
+		}
+		if !reflect.DeepEqual(got, names) {
+			t.Errorf("names (%.4d): expected %q, got %q", i, names, got)
+		}
+	}
+
+	b = NewBuffer(PutUint16(nil, 3))
+	b.Names()
+	if b.Err() != io.ErrUnexpectedEOF {
+		t.Errorf("names: expected unexpected EOF error, got %v", b.Err())
+	}
+
+	b = NewBuffer(PutString(PutUint16(nil, 2), "usr"))
+	b.data = append(b.data, 0xff, 0x00)
+	b.Names()
+	if b.Err() != io.ErrUnexpectedEOF {
+		t.Errorf("names: expected unexpected EOF error, got %v", b.Err())
+	}
+}
+
+func TestExpect(t *testing.T) {
+	t.Parallel()
+
+	data := PutUint8(PutUint32(nil, 0xcafebabe), 2)
+	b := NewBuffer(data)
+	if err := b.ExpectUint32(0xcafebabe); err != nil {
+		t.Fatalf("expect: unexpected magic error: %v", err)
+	}
+	if err := b.ExpectUint8(2); err != nil {
+		t.Fatalf("expect: unexpected version error: %v", err)
+	}
+
+	b = NewBuffer(data)
+	err := b.ExpectUint32(0xdeadbeef)
+	if !errors.Is(err, ErrMagicMismatch) || err.Error() != "wire: magic mismatch: got 0xcafebabe want 0xdeadbeef" {
+		t.Fatalf("expect: expected magic mismatch, got %v", err)
+	}
+	if b.ExpectUint8(2) != err {
+		t.Fatalf("expect: expected sticky buffer error")
+	}
+
+	b = NewBuffer(data)
+	b.ExpectUint32(0xcafebabe)
+	err = b.ExpectUint8(1)
+	if !errors.Is(err, ErrVersionMismatch) || err.Error() != "wire: version mismatch: got 0x2 want 0x1" {
+		t.Fatalf("expect: expected version mismatch, got %v", err)
+	}
+
+	b = NewBuffer(data[:2])
+	if err := b.ExpectUint32(0xcafebabe); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect: expected unexpected EOF, got %v", err)
+	}
+}
+
+func TestOptionalStrings(t *testing.T) {
+	t.Parallel()
+
+	empty, names := []string{}, []string{"usr", "local"}
+	b := NewBuffer(nil)
+	for i, testcase := range []struct {
+		v    *[]string
+		size int
+	}{
+		{nil, 1},
+		{&empty, 3},
+		{&names, 3 + 5 + 7},
+	} {
+		b.Reset()
+		b.PutOptionalStrings(testcase.v)
+		if b.Len() != testcase.size {
+			t.Errorf("optional strings (%.4d): expected size %d, got %d", i, testcase.size, b.Len())
+		}
+
+		got := b.OptionalStrings()
+		if err := b.Err(); err != nil {
+			t.Fatalf("optional strings (%.4d): %v", i, err)
+		}
+		if b.Len() != 0 {
+			t.Fatalf("optional strings (%.4d): %d trailing bytes", i, b.Len())
+		}
+		switch {
+		case testcase.v == nil && got != nil:
+			t.Errorf("optional strings (%.4d): expected absent list, got %q", i, *got)
+		case testcase.v != nil && (got == nil || *got == nil || !reflect.DeepEqual(*got, *testcase.v)):
+			t.Errorf("optional strings (%.4d): expected %q, got %v", i, *testcase.v, got)
+		}
+	}
+
+	b = NewBuffer([]byte{2})
+	b.OptionalStrings()
+	if b.Err() == nil {
+		t.Fatalf("optional strings: expected invalid presence byte error")
+	}
+}
+
+func TestBitset64(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	for i, testcase := range []struct {
+		set  []uint8
+		want []uint8
+	}{
+		{[]uint8{0, 1, 2, 63}, []uint8{0, 1, 2, 63}},
+		{[]uint8{42, 7, 7, 3}, []uint8{3, 7, 42}},
+		{[]uint8{}, []uint8{}},
+		{nil, []uint8{}},
+	} {
+		b.Reset()
+		b.PutBitset64(testcase.set)
+		if b.Len() != 8 {
+			t.Errorf("bitset64 (%.4d): expected size 8, got %d", i, b.Len())
+		}
+
+		got := b.Bitset64()
+		if err := b.Err(); err != nil {
+			t.Fatalf("bitset64 (%.4d): %v", i, err)
+		}
+		if !reflect.DeepEqual(got, testcase.want) {
+			t.Errorf("bitset64 (%.4d): expected %v, got %v", i, testcase.want, got)
+		}
+	}
+
+	b.Reset()
+	b.PutBitset64([]uint8{1, 64})
+	if b.Err() == nil {
+		t.Errorf("bitset64: expected out of range error")
+	}
+	if b.Len() != 0 {
+		t.Errorf("bitset64: expected empty buffer, got %d", b.Len())
+	}
+}
+
+func TestMaxBufSize(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil, WithMaxBufSize(8))
+	b.PutUint32(42)
+	b.PutUint16(42)
+	if err := b.Err(); err != nil {
+		t.Fatalf("maxbufsize: %v", err)
+	}
+
+	b.PutUint32(42)
+	if b.Err() != ErrBufferFull {
+		t.Fatalf("maxbufsize: expected buffer full error, got %v", b.Err())
+	}
+	if b.Len() != 6 {
+		t.Fatalf("maxbufsize: expected buffer size 6, got %d", b.Len())
+	}
+
+	b.Reset()
+	b.PutBytes(make([]byte, 5))
+	if b.Err() != ErrBufferFull {
+		t.Fatalf("maxbufsize: expected buffer full error, got %v", b.Err())
+	}
+	if n, err := b.Write(make([]byte, 9)); n != 0 || err != ErrBufferFull {
+		t.Fatalf("maxbufsize: expected buffer full error, got %d, %v", n, err)
+	}
+	if n, err := b.WriteString("abcdefgh"); n != 8 || err != nil {
+		t.Fatalf("maxbufsize: expected 8 written bytes, got %d, %v", n, err)
+	}
+}
+
+func TestRaw(t *testing.T) {
+	t.Parallel()
+
+	cookie := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	b := NewBuffer(nil)
+	b.Write(cookie)
+	b.PutUint8(42)
+
+	got := b.Raw(len(cookie))
+	if err := b.Err(); err != nil {
+		t.Fatalf("raw: %v", err)
+	}
+	if !bytes.Equal(got, cookie) {
+		t.Fatalf("raw: expected %v, got %v", cookie, got)
+	}
+	if v := b.Uint8(); v != 42 {
+		t.Fatalf("raw: expected trailing value 42, got %d", v)
+	}
+
+	b.Raw(1)
+	if b.Err() != io.ErrUnexpectedEOF {
+		t.Fatalf("raw: expected unexpected EOF error, got %v", b.Err())
+	}
+}
+
+func TestHeader(t *testing.T) {
+	t.Parallel()
+
+	want := Header{Type: 100, Tag: math.MaxUint16}
+	b := NewBuffer(nil)
+	b.PutHeader(want)
+	if b.Len() != 3 || b.Len() != SizeOf(want) {
+		t.Fatalf("header: expected size 3, got %d", b.Len())
+	}
+
+	h, err := b.Header()
+	if err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	if h != want {
+		t.Fatalf("header: expected %+v, got %+v", want, h)
+	}
+
+	if _, err = NewBuffer([]byte{100, 0}).Header(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("header: expected unexpected EOF error, got %v", err)
+	}
+}
+
+func TestSubMessage(t *testing.T) {
+	t.Parallel()
+
+	inner := NewBuffer(nil)
+	inner.Marshal(uint32(42), "hello world")
+
+	b := NewBuffer(nil, WithShortStructs())
+	b.PutBytes(inner.data)
+	b.PutUint8(7)
+
+	sub := b.SubMessage()
+	if sub.Len() != inner.Len() {
+		t.Fatalf("submessage: expected size %d, got %d", inner.Len(), sub.Len())
+	}
+	if !sub.shortStructs {
+		t.Fatalf("submessage: expected options to be inherited")
+	}
+	var (
+		v   uint32
+		str string
+		x   uint8
+	)
+	if err := sub.Unmarshal(&v, &str); err != nil {
+		t.Fatalf("submessage: %v", err)
+	}
+	if v != 42 || str != "hello world" {
+		t.Fatalf("submessage: unexpected values %d, %q", v, str)
+	}
+	if sub.Unmarshal(&x) != io.ErrUnexpectedEOF {
+		t.Fatalf("submessage: expected decoding to be bounded")
+	}
+	if x = b.Uint8(); x != 7 {
+		t.Fatalf("submessage: expected trailing value 7, got %d", x)
+	}
+
+	b = NewBuffer(PutUint32(nil, 8))
+	if sub = b.SubMessage(); sub.Err() != io.ErrUnexpectedEOF || b.Err() != io.ErrUnexpectedEOF {
+		t.Fatalf("submessage: expected unexpected EOF error, got %v", sub.Err())
+	}
+}
+
+func TestOptional(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	b.PutUint16(3)
+	b.PutOptional(1, func(b *Buffer) { b.PutString("hello world") })
+	b.PutOptional(42, func(b *Buffer) { b.PutUint64(math.MaxUint64) })
+	b.PutOptional(2, func(b *Buffer) { b.PutUint32(7) })
+	b.PutUint8(0xff)
+
+	var (
+		str string
+		v   uint32
+		ids []uint16
+	)
+	err := b.RangeOptional(func(id uint16, sub *Buffer) error {
+		ids = append(ids, id)
+		switch id {
+		case 1:
+			str = sub.String()
+		case 2:
+			v = sub.Uint32()
+		}
+		return sub.Err()
+	})
+	if err != nil {
+		t.Fatalf("optional: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []uint16{1, 42, 2}) {
+		t.Fatalf("optional: expected ids [1 42 2], got %v", ids)
+	}
+	if str != "hello world" || v != 7 {
+		t.Fatalf("optional: unexpected values %q, %d", str, v)
+	}
+	if x := b.Uint8(); x != 0xff {
+		t.Fatalf("optional: expected trailing value 0xff, got %#x", x)
+	}
+
+	b = NewBuffer(nil)
+	b.PutUint16(1)
+	b.PutOptional(1, func(b *Buffer) { b.PutUint32(7) })
+	stop := errors.New("stop")
+	if err = b.RangeOptional(func(uint16, *Buffer) error { return stop }); err != stop {
+		t.Fatalf("optional: expected handler error, got %v", err)
+	}
+}
+
+func TestHash64(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	if h := b.Hash64(); h != 0xcbf29ce484222325 {
+		t.Fatalf("hash64: expected FNV-1a offset basis for empty buffer, got %#x", h)
+	}
+
+	b.Marshal(uint32(42), "hello world")
+	size := b.Len()
+	h1 := b.Hash64()
+	if b.Len() != size {
+		t.Fatalf("hash64: expected unconsumed buffer of size %d, got %d", size, b.Len())
+	}
+
+	h2, err := HashOf(uint32(42), "hello world")
+	if err != nil {
+		t.Fatalf("hash64: %v", err)
+	}
+	if h1 != h2 {
+		t.Fatalf("hash64: expected equal hashes, got %#x and %#x", h1, h2)
+	}
+	if h3, _ := HashOf(uint32(42), "hello World"); h3 == h1 {
+		t.Fatalf("hash64: expected different hashes for different messages")
+	}
+	if _, err = HashOf(float64(42)); err == nil {
+		t.Fatalf("hash64: expected encode error")
+	}
+}
+
+func TestPeakCap(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(make([]byte, 0, 16))
+	if b.PeakCap() != 16 {
+		t.Fatalf("peakcap: expected 16, got %d", b.PeakCap())
+	}
+
+	b.Write(make([]byte, 100))
+	peak := b.PeakCap()
+	if peak < 100 || peak != cap(b.data) {
+		t.Fatalf("peakcap: expected capacity %d, got %d", cap(b.data), peak)
+	}
+	b.Read(make([]byte, 50))
+	b.Reset()
+	if b.PeakCap() != peak {
+		t.Fatalf("peakcap: expected %d after reset, got %d", peak, b.PeakCap())
+	}
+
+	b.SetBuf(make([]byte, 0, 8))
+	b.ResetStats()
+	if b.PeakCap() != 8 {
+		t.Fatalf("peakcap: expected 8 after reset stats, got %d", b.PeakCap())
+	}
+}
+
+func TestVarSection(t *testing.T) {
+	t.Parallel()
+
+	b := NewBuffer(nil)
+	b.PutUint8(1)
+	mark := b.StartVarSection()
+	b.PutString("hello world")
+	b.EndVarSection(mark)
+	mark = b.StartVarSection()
+	b.Write(make([]byte, 300))
+	b.EndVarSection(mark)
+	b.PutUint8(2)
+
+	if want := 1 + 1 + 13 + 2 + 300 + 1; b.Len() != want {
+		t.Fatalf("varsection: expected size %d, got %d", want, b.Len())
+	}
+
+	if v := b.Uint8(); v != 1 {
+		t.Fatalf("varsection: expected leading value 1, got %d", v)
+	}
+	sub := b.VarSection()
+	if str := sub.String(); str != "hello world" || sub.Len() != 0 {
+		t.Fatalf("varsection: expected %q, got %q (%d bytes left)", "hello world", str, sub.Len())
+	}
+	if sub = b.VarSection(); sub.Len() != 300 {
+		t.Fatalf("varsection: expected section size 300, got %d", sub.Len())
+	}
+	if v := b.Uint8(); v != 2 || b.Err() != nil {
+		t.Fatalf("varsection: expected trailing value 2, got %d (%v)", v, b.Err())
+	}
+
+	b = NewBuffer(nil)
+	b.EndVarSection(3)
+	if b.Err() == nil {
+		t.Fatalf("varsection: expected invalid mark error")
+	}
+
+	b = NewBuffer(nil)
+	b.PutUint8(9)
+	mark = b.StartVarSection()
+	b.PutString("hi")
+	b.Uint8() // shifts the unread portion and invalidates mark
+	b.EndVarSection(mark)
+	if b.Err() == nil {
+		t.Fatalf("varsection: expected invalid mark error after read")
+	}
+}
+
+func TestMaxValueLen(t *testing.T) {
+	t.Parallel()
+
+	data := NewBuffer(nil)
+	data.Marshal("hello", []byte("hello"), "hello world", []byte("hello world"))
+
+	b := NewBuffer(data.data, WithMaxStringLen(5), WithMaxBytesLen(5))
+	if str := b.String(); str != "hello" {
+		t.Fatalf("maxlen: expected %q, got %q", "hello", str)
+	}
+	if v := b.Bytes(); string(v) != "hello" {
+		t.Fatalf("maxlen: expected %q, got %q", "hello", v)
+	}
+	if str := b.String(); str != "" || b.Err() != ErrValueTooLarge {
+		t.Fatalf("maxlen: expected value too large error, got %q (%v)", str, b.Err())
+	}
+
+	b = NewBuffer(data.data[16:], WithMaxBytesLen(5))
+	var str string
+	var v []byte
+	if err := b.Unmarshal(&str, &v); err != ErrValueTooLarge {
+		t.Fatalf("maxlen: expected value too large error, got %v", err)
+	}
+}
+
+var benchUint64 uint64
+
+func BenchmarkConsumeUint64(b *testing.B) {
+	data := PutUint64(nil, math.MaxUint64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		v, _ := ConsumeUint64(data)
+		benchUint64 += v
+	}
+}
+
+func BenchmarkConsumeUint64Stdlib(b *testing.B) {
+	data := PutUint64(nil, math.MaxUint64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if len(data) < 8 {
+			b.Fatal("short buffer")
+		}
+		benchUint64 += binary.LittleEndian.Uint64(data)
+	}
+}